@@ -26,6 +26,15 @@ var (
 	}
 )
 
+// SetHTTPClient method will replace the client used to send the hits eg: with
+// the client of a request.Client created with request.NewTransport so that the
+// connection pool is shared with the rest of the service
+func SetHTTPClient(client *netHttp.Client) {
+	mu.Lock()
+	requestClient = client
+	mu.Unlock()
+}
+
 // Analytics struct contains the information which can be sent to
 type Analytics struct {
 	ClientID        string
@@ -56,6 +65,7 @@ func (queue *Queue) Push(data *Analytics) {
 	mu.Lock()
 	queue.CC++
 	var currentGACount = queue.CC
+	var client = requestClient
 	mu.Unlock()
 
 	if currentGACount <= queue.SendCount {
@@ -82,7 +92,7 @@ func (queue *Queue) Push(data *Analytics) {
 		q.Add("dt", data.DocumentTitle)
 		req.URL.RawQuery = q.Encode()
 
-		var resp, reqErr = requestClient.Do(req)
+		var resp, reqErr = client.Do(req)
 		if reqErr == nil {
 			resp.Body.Close()
 		}
@@ -14,4 +14,5 @@ require (
 	github.com/oschwald/maxminddb-golang v1.8.0
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	go.mongodb.org/mongo-driver v1.5.2
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -1,48 +1,89 @@
 package maxmind
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/oschwald/geoip2-golang"
 )
 
-var cityDb *geoip2.Reader
-var ispDb *geoip2.Reader
-var connDb *geoip2.Reader
+// ErrNotLoaded is returned when the database needed for the lookup was not opened
+var ErrNotLoaded = errors.New("maxmind: database is not loaded")
+
+// ErrInvalidIP is returned when the ip can not be parsed
+var ErrInvalidIP = errors.New("maxmind: invalid ip address")
+
+// defaultReader is used by the package functions, it is set by Connect. The
+// lookups hold the read lock so that Connect and Close never close a reader in use
+var defaultReader = &Reader{}
+var defaultMu sync.RWMutex
 
 type City struct {
 	Name, State, Country string
 	Latitude, Longitude  float64
 }
 
-func Connect(cityDbPath, ispDbPath, connDbPath string) {
-	var err error
-	cityDb, err = geoip2.Open(cityDbPath)
-	if err != nil {
-		panic(err)
-	}
+// Paths struct contains the paths of the database files, the empty ones are not opened
+type Paths struct {
+	City, ISP, ConnType string
+}
 
-	ispDb, err = geoip2.Open(ispDbPath)
-	if err != nil {
-		panic(err)
+// Reader struct contains the opened databases, it is safe for concurrent use
+type Reader struct {
+	cityDb *geoip2.Reader
+	ispDb  *geoip2.Reader
+	connDb *geoip2.Reader
+}
+
+// Open method will open the databases of the paths, the databases opened
+// before the error are closed when any of them fails
+func Open(paths Paths) (*Reader, error) {
+	if paths.City == "" && paths.ISP == "" && paths.ConnType == "" {
+		return nil, errors.New("maxmind: no database path given")
+	}
+	var r = &Reader{}
+	var dbs = []struct {
+		path string
+		db   **geoip2.Reader
+	}{{paths.City, &r.cityDb}, {paths.ISP, &r.ispDb}, {paths.ConnType, &r.connDb}}
+	for _, d := range dbs {
+		if d.path == "" {
+			continue
+		}
+		var db, err = geoip2.Open(d.path)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("maxmind: open %s: %w", d.path, err)
+		}
+		*d.db = db
 	}
+	return r, nil
+}
 
-	connDb, err = geoip2.Open(connDbPath)
-	if err != nil {
-		panic(err)
+func parseIP(ip string) (net.IP, error) {
+	var netIP = net.ParseIP(ip)
+	if netIP == nil {
+		return nil, ErrInvalidIP
 	}
+	return netIP, nil
 }
 
-func CityData(ip string) City {
-	netIP := net.ParseIP(ip)
-	record, err := cityDb.City(netIP)
-	if err != nil || record == nil {
-		cityObj := City{"XX", "XX", "XX", 0, 0}
-		return cityObj
+// City method will return the city of the ip
+func (r *Reader) City(ip string) (City, error) {
+	if r.cityDb == nil {
+		return City{}, ErrNotLoaded
+	}
+	netIP, err := parseIP(ip)
+	if err != nil {
+		return City{}, err
+	}
+	record, err := r.cityDb.City(netIP)
+	if err != nil {
+		return City{}, err
 	}
 	cityObj := City{}
-
 	cityObj.Name = record.City.Names["en"]
 	cityObj.Country = record.Country.IsoCode
 	if len(record.Subdivisions) > 0 {
@@ -50,37 +91,109 @@ func CityData(ip string) City {
 	}
 	cityObj.Latitude = record.Location.Latitude
 	cityObj.Longitude = record.Location.Longitude
-	return cityObj
+	return cityObj, nil
 }
 
-func ConnType(ip string) string {
-	netIP := net.ParseIP(ip)
-	record, err := connDb.ConnectionType(netIP)
+// ISP method will return the isp name of the ip
+func (r *Reader) ISP(ip string) (string, error) {
+	if r.ispDb == nil {
+		return "", ErrNotLoaded
+	}
+	netIP, err := parseIP(ip)
+	if err != nil {
+		return "", err
+	}
+	record, err := r.ispDb.ISP(netIP)
 	if err != nil {
-		return ""
+		return "", err
 	}
-	return record.ConnectionType
+	return record.ISP, nil
 }
 
-func ISP(ip string) string {
-	netIP := net.ParseIP(ip)
-	record, err := ispDb.ISP(netIP)
+// ConnType method will return the connection type of the ip eg: Cellular
+func (r *Reader) ConnType(ip string) (string, error) {
+	if r.connDb == nil {
+		return "", ErrNotLoaded
+	}
+	netIP, err := parseIP(ip)
 	if err != nil {
-		return "XX"
+		return "", err
 	}
-	return record.ISP
+	record, err := r.connDb.ConnectionType(netIP)
+	if err != nil {
+		return "", err
+	}
+	return record.ConnectionType, nil
 }
 
-// Close method will close the maxmind db files
-func Close() {
-	fmt.Println("closing maxmind db files!!")
-	if cityDb != nil {
-		cityDb.Close()
+// Close method will close the opened databases and return the first error
+func (r *Reader) Close() error {
+	var firstErr error
+	for _, db := range []*geoip2.Reader{r.cityDb, r.ispDb, r.connDb} {
+		if db == nil {
+			continue
+		}
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
-	if ispDb != nil {
-		ispDb.Close()
+	return firstErr
+}
+
+// Connect function opens the databases used by the package functions, it
+// panics when a file can not be opened. Use Open to handle the error instead.
+// The databases of an earlier call are closed once the new ones are in place
+func Connect(cityDbPath, ispDbPath, connDbPath string) {
+	var r, err = Open(Paths{City: cityDbPath, ISP: ispDbPath, ConnType: connDbPath})
+	if err != nil {
+		panic(err)
+	}
+	defaultMu.Lock()
+	var old = defaultReader
+	defaultReader = r
+	defaultMu.Unlock()
+	old.Close()
+}
+
+// CityData function returns the city of the ip using the databases opened by
+// Connect, the fields are "XX" when the lookup fails
+func CityData(ip string) City {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	cityObj, err := defaultReader.City(ip)
+	if err != nil {
+		return City{"XX", "XX", "XX", 0, 0}
 	}
-	if connDb != nil {
-		connDb.Close()
+	return cityObj
+}
+
+// ConnType function returns the connection type of the ip using the databases
+// opened by Connect, it is empty when the lookup fails
+func ConnType(ip string) string {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	connType, _ := defaultReader.ConnType(ip)
+	return connType
+}
+
+// ISP function returns the isp of the ip using the databases opened by
+// Connect, it is "XX" when the lookup fails
+func ISP(ip string) string {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	isp, err := defaultReader.ISP(ip)
+	if err != nil {
+		return "XX"
 	}
+	return isp
+}
+
+// Close method will close the databases opened by Connect, the lookups after
+// it fail as if the databases were never loaded
+func Close() error {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	var err = defaultReader.Close()
+	defaultReader = &Reader{}
+	return err
 }
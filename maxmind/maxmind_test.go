@@ -0,0 +1,207 @@
+package maxmind
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// encodeData encodes v in the data format of the MaxMind DB, only the types
+// used by the test databases are supported
+func encodeData(buf *bytes.Buffer, v interface{}) {
+	var control = func(typ byte, size int) {
+		if typ > 7 {
+			buf.WriteByte(byte(size))
+			buf.WriteByte(typ - 7)
+			return
+		}
+		buf.WriteByte(typ<<5 | byte(size))
+	}
+	var unsigned = func(typ byte, n uint64) {
+		var b = make([]byte, 8)
+		binary.BigEndian.PutUint64(b, n)
+		b = bytes.TrimLeft(b, "\x00")
+		control(typ, len(b))
+		buf.Write(b)
+	}
+	switch v := v.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case float64:
+		control(3, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		unsigned(5, uint64(v))
+	case uint32:
+		unsigned(6, uint64(v))
+	case uint64:
+		unsigned(9, v)
+	case []interface{}:
+		control(11, len(v))
+		for _, item := range v {
+			encodeData(buf, item)
+		}
+	case map[string]interface{}:
+		control(7, len(v))
+		var keys = make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeData(buf, k)
+			encodeData(buf, v[k])
+		}
+	}
+}
+
+// writeTestDB writes an IPv4 database of the type with the record for the
+// network, the other addresses are not found
+func writeTestDB(t *testing.T, dbType, network string, record map[string]interface{}) string {
+	t.Helper()
+	var _, ipNet, err = net.ParseCIDR(network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ip = ipNet.IP.To4()
+	var bits, _ = ipNet.Mask.Size()
+	// one node for every bit of the network, the record of the other branch is empty
+	var nodeCount = uint32(bits)
+	var buf bytes.Buffer
+	for i := 0; i < bits; i++ {
+		var next = uint32(i + 1)
+		if i == bits-1 {
+			// the data is the first record of the data section
+			next = nodeCount + 16
+		}
+		var records = [2]uint32{nodeCount, nodeCount}
+		records[ip[i/8]>>(7-uint(i%8))&1] = next
+		for _, r := range records {
+			buf.Write([]byte{byte(r >> 16), byte(r >> 8), byte(r)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	encodeData(&buf, record)
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeData(&buf, map[string]interface{}{
+		"node_count":                  nodeCount,
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               dbType,
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1600000000),
+		"description":                 map[string]interface{}{"en": "test database"},
+	})
+
+	var path = filepath.Join(t.TempDir(), dbType+".mmdb")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testPaths(t *testing.T) Paths {
+	return Paths{
+		City: writeTestDB(t, "GeoIP2-City", "81.2.69.0/24", map[string]interface{}{
+			"city":         map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+			"country":      map[string]interface{}{"iso_code": "GB"},
+			"subdivisions": []interface{}{map[string]interface{}{"names": map[string]interface{}{"en": "England"}}},
+			"location":     map[string]interface{}{"latitude": 51.5142, "longitude": -0.0931},
+		}),
+		ISP:      writeTestDB(t, "GeoIP2-ISP", "1.128.0.0/11", map[string]interface{}{"isp": "Telstra Internet"}),
+		ConnType: writeTestDB(t, "GeoIP2-Connection-Type", "1.0.1.0/24", map[string]interface{}{"connection_type": "Cellular"}),
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var r, err = Open(testPaths(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	city, err := r.City("81.2.69.142")
+	var want = City{Name: "London", State: "England", Country: "GB", Latitude: 51.5142, Longitude: -0.0931}
+	if err != nil || city != want {
+		t.Errorf("City got %+v %v, want %+v", city, err, want)
+	}
+	if city, err := r.City("8.8.8.8"); err != nil || city != (City{}) {
+		t.Errorf("City of an unknown ip got %+v %v", city, err)
+	}
+	if isp, err := r.ISP("1.128.0.1"); err != nil || isp != "Telstra Internet" {
+		t.Errorf("ISP got %q %v", isp, err)
+	}
+	if connType, err := r.ConnType("1.0.1.1"); err != nil || connType != "Cellular" {
+		t.Errorf("ConnType got %q %v", connType, err)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open(Paths{}); err == nil {
+		t.Error("no paths got no error")
+	}
+	var paths = testPaths(t)
+	paths.ISP = filepath.Join(t.TempDir(), "missing.mmdb")
+	if _, err := Open(paths); err == nil {
+		t.Error("a missing file got no error")
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	var r, err = Open(Paths{City: testPaths(t).City})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := r.ISP("1.128.0.1"); !errors.Is(err, ErrNotLoaded) {
+		t.Errorf("ISP got %v, want ErrNotLoaded", err)
+	}
+	if _, err := r.ConnType("1.0.1.1"); !errors.Is(err, ErrNotLoaded) {
+		t.Errorf("ConnType got %v, want ErrNotLoaded", err)
+	}
+	for _, ip := range []string{"", "81.2.69", "not an ip"} {
+		if _, err := r.City(ip); !errors.Is(err, ErrInvalidIP) {
+			t.Errorf("City(%q) got %v, want ErrInvalidIP", ip, err)
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	var paths = testPaths(t)
+	Connect(paths.City, "", "")
+	if city := CityData("81.2.69.142"); city.Name != "London" {
+		t.Errorf("CityData got %+v", city)
+	}
+	if isp := ISP("1.128.0.1"); isp != "XX" {
+		t.Errorf("ISP without the database got %q, want XX", isp)
+	}
+
+	// connecting again replaces the databases
+	Connect("", paths.ISP, paths.ConnType)
+	if city := CityData("81.2.69.142"); city.Name != "XX" {
+		t.Errorf("CityData after the reconnect got %+v, want XX", city)
+	}
+	if isp := ISP("1.128.0.1"); isp != "Telstra Internet" {
+		t.Errorf("ISP got %q", isp)
+	}
+	if connType := ConnType("1.0.1.1"); connType != "Cellular" {
+		t.Errorf("ConnType got %q", connType)
+	}
+
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if isp := ISP("1.128.0.1"); isp != "XX" {
+		t.Errorf("ISP after Close got %q, want XX", isp)
+	}
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/trustsignalio/golangutils/cache"
+	"github.com/trustsignalio/golangutils/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Store struct runs the model helpers on the mongodb.Database interface so that
+// the in-memory database of mongodb/memdb can be used in place of MongoDB
+type Store struct {
+	db mongodb.Database
+}
+
+// NewStore method will return a store on the database eg: memdb.New("test") or
+// mongodb.NewDatabase(client.GetDb())
+func NewStore(db mongodb.Database) *Store {
+	return &Store{db: db}
+}
+
+// Database method will return the database of the store
+func (s *Store) Database() mongodb.Database {
+	return s.db
+}
+
+func (s *Store) collection(model Model) mongodb.Collection {
+	return s.db.Collection(model.Table())
+}
+
+// CountDocs method will count the documents in a table based on query supplied
+func (s *Store) CountDocs(model Model, query bson.M) int64 {
+	var duration = time.Second
+	var opts = &options.CountOptions{MaxTime: &duration}
+	var result, _ = s.collection(model).CountDocuments(context.Background(), query, opts)
+	return result
+}
+
+// Aggregate method will aggregate the collection and return the results accordingly
+func (s *Store) Aggregate(model Model, extra *AggregateOpts) ([]interface{}, error) {
+	var opts = &options.AggregateOptions{MaxTime: &extra.MaxTime}
+	var cursor, err = s.collection(model).Aggregate(context.Background(), aggregatePipeline(extra), opts)
+	if err != nil {
+		return nil, err
+	}
+	var results []interface{}
+	err = cursor.All(context.Background(), &results)
+	return results, err
+}
+
+// FindOne method will try to find the object with given query
+func (s *Store) FindOne(model Model, query bson.M) Model {
+	var duration = time.Second
+	var opts = &options.FindOneOptions{MaxTime: &duration}
+	var result = s.collection(model).FindOne(context.Background(), query, opts)
+	if result.Err() == nil {
+		result.Decode(model)
+	}
+	return model
+}
+
+// DeleteOne method will delete a single document based on the query
+func (s *Store) DeleteOne(model Model, query bson.M) bool {
+	var _, err = s.collection(model).DeleteOne(context.Background(), query, &options.DeleteOptions{})
+	return err == nil
+}
+
+// DeleteMany method will delete multiple documents based on the filter
+func (s *Store) DeleteMany(model Model, query bson.M) bool {
+	var _, err = s.collection(model).DeleteMany(context.Background(), query, &options.DeleteOptions{})
+	return err == nil
+}
+
+// FindAll will try to find the documents based on the query
+func (s *Store) FindAll(model Model, query bson.M, queryOpts *FindOptions) []interface{} {
+	var opts = findOptions(queryOpts)
+	if queryOpts != nil {
+		opts.BatchSize = nil
+	}
+	var cur, err = s.collection(model).Find(context.Background(), query, opts)
+	var dataArr []interface{}
+	if err != nil {
+		return dataArr
+	}
+	defer cur.Close(context.Background())
+	for cur.Next(context.Background()) {
+		var dummyObj = model.New()
+		err := cur.Decode(dummyObj)
+		if err == nil {
+			dataArr = append(dataArr, dummyObj)
+		}
+	}
+	return dataArr
+}
+
+// FindOneWithOpts method will try to find the object based on the query and options
+func (s *Store) FindOneWithOpts(model Model, query bson.M, queryOpts *FindOptions) Model {
+	var duration = time.Second
+	var opts = &options.FindOneOptions{MaxTime: &duration}
+	if queryOpts != nil {
+		opts.Sort = queryOpts.Sort
+		opts.Hint = queryOpts.Hint
+		opts.Skip = queryOpts.Skip
+		if queryOpts.Timeout > 0 {
+			opts.MaxTime = &queryOpts.Timeout
+		}
+	}
+	var result = s.collection(model).FindOne(context.Background(), query, opts)
+	if result.Err() == nil {
+		result.Decode(model)
+	}
+	return model
+}
+
+// Save method will save the document in db and update the cache
+func (s *Store) Save(cacheClient *cache.Client, model Model, id string) error {
+	var err error
+	if model.IsEmpty() {
+		_, err = s.collection(model).InsertOne(context.Background(), model)
+	} else {
+		var upsert = true
+		var updateOpts = &options.UpdateOptions{Upsert: &upsert}
+		_, err = s.collection(model).UpdateOne(context.Background(), idQuery(id), bson.M{"$set": model}, updateOpts)
+	}
+	clearCache(cacheClient, model, id)
+	model.ClearCacheData(cacheClient)
+	return err
+}
+
+// Query method will return cursor to the database
+func (s *Store) Query(model Model, query bson.M, queryOpts *FindOptions) (mongodb.Cursor, error) {
+	var opts = findOptions(queryOpts)
+	if queryOpts != nil {
+		opts.Projection = nil
+	}
+	return s.collection(model).Find(context.Background(), query, opts)
+}
+
+// InsertMany method will insert documents in bulk inside the collection
+func (s *Store) InsertMany(model Model, docs []interface{}) ([]interface{}, error) {
+	var ordered = false
+	var opts = &options.InsertManyOptions{Ordered: &ordered}
+	r, err := s.collection(model).InsertMany(context.Background(), docs, opts)
+	if r != nil {
+		return r.InsertedIDs, err
+	}
+	return nil, err
+}
+
+// UpdateMany will update the rows of the table based on the query supplied
+func (s *Store) UpdateMany(model Model, query, updateObj bson.M) error {
+	_, err := s.collection(model).UpdateMany(context.Background(), query, updateObj, &options.UpdateOptions{})
+	return err
+}
+
+// FindByID method will try to find the document of the model with given id
+func (s *Store) FindByID(model Model, id string) mongodb.SingleResult {
+	var duration = time.Second
+	var opts = &options.FindOneOptions{MaxTime: &duration}
+	return s.collection(model).FindOne(context.Background(), idQuery(id), opts)
+}
+
+// CacheFirst method will try to find the object with given id in cache else it
+// will query the db by id and save the result in cache. Unlike the CacheFirst
+// function the document is decoded in a new model instead of calling Model.FindOne
+func (s *Store) CacheFirst(cacheClient *cache.Client, model Model, id string) Model {
+	var cacheKey = GetCacheKey(model, id)
+	var result, found = cacheClient.Get(cacheKey)
+	if found {
+		return result.(Model)
+	}
+	var r = model.New()
+	if single := s.FindByID(model, id); single.Err() == nil {
+		single.Decode(r)
+	}
+	cacheClient.Set(cacheKey, r)
+	return r
+}
+
+func aggregatePipeline(extra *AggregateOpts) []bson.M {
+	var pipeline []bson.M
+	project := bson.M{}
+	for _, p := range extra.Project {
+		project[p] = 1
+	}
+	pipeline = append(pipeline, bson.M{"$match": extra.Match})
+	pipeline = append(pipeline, bson.M{"$project": project})
+	pipeline = append(pipeline, bson.M{"$group": extra.Group})
+	if extra.Limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": extra.Limit})
+	}
+	return pipeline
+}
+
+// findOptions converts the options, the callers reset the fields which they
+// did not pass to the driver before
+func findOptions(queryOpts *FindOptions) *options.FindOptions {
+	var duration = time.Second
+	var opts = &options.FindOptions{MaxTime: &duration}
+	if queryOpts != nil {
+		opts.Sort = queryOpts.Sort
+		opts.Hint = queryOpts.Hint
+		opts.Limit = queryOpts.Limit
+		opts.Skip = queryOpts.Skip
+		opts.Projection = queryOpts.Projection
+		opts.BatchSize = queryOpts.BatchSize
+		if queryOpts.Timeout > 0 {
+			opts.MaxTime = &queryOpts.Timeout
+		}
+	}
+	return opts
+}
+
+// idQuery returns the query of the id, ids of 24 chars are converted to ObjectID
+func idQuery(id string) bson.M {
+	var query = bson.M{"_id": id}
+	if len(id) == 24 {
+		query["_id"], _ = primitive.ObjectIDFromHex(id)
+	}
+	return query
+}
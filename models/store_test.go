@@ -0,0 +1,102 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/trustsignalio/golangutils/cache"
+	"github.com/trustsignalio/golangutils/mongodb/memdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type testCampaign struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	Site   string             `bson:"site"`
+	Clicks int32              `bson:"clicks"`
+}
+
+func (c *testCampaign) New() Model {
+	return &testCampaign{}
+}
+
+func (c *testCampaign) Table() string {
+	return "campaigns"
+}
+
+func (c *testCampaign) IsEmpty() bool {
+	return c.ID.IsZero()
+}
+
+func (c *testCampaign) FindOne(db *mongo.Database, id string) Model {
+	return FindOne(db, c, bson.M{"_id": ConvertID(id)})
+}
+
+func (c *testCampaign) ClearCacheData(cacheClient *cache.Client) {}
+
+func TestStoreWithMemdb(t *testing.T) {
+	var store = NewStore(memdb.New("test"))
+	var cacheClient = cache.NewClient("test", 1)
+	var model = &testCampaign{}
+
+	var inserted, err = store.InsertMany(model, []interface{}{
+		&testCampaign{ID: NewMongoID(), Site: "a", Clicks: 1},
+		&testCampaign{ID: NewMongoID(), Site: "a", Clicks: 2},
+		&testCampaign{ID: NewMongoID(), Site: "b", Clicks: 3},
+	})
+	if err != nil || len(inserted) != 3 {
+		t.Fatalf("insert: %v %v", inserted, err)
+	}
+	var firstID = inserted[0].(primitive.ObjectID)
+
+	if n := store.CountDocs(model, bson.M{"site": "a"}); n != 2 {
+		t.Errorf("count got %d, want 2", n)
+	}
+
+	var limit int64 = 2
+	var all = store.FindAll(model, bson.M{}, &FindOptions{Sort: bson.M{"clicks": -1}, Limit: &limit})
+	if len(all) != 2 || all[0].(*testCampaign).Clicks != 3 {
+		t.Errorf("find all got %v", all)
+	}
+
+	var found = store.FindOne(&testCampaign{}, bson.M{"_id": firstID}).(*testCampaign)
+	if found.Site != "a" {
+		t.Errorf("find one got %+v", found)
+	}
+
+	found.Clicks = 10
+	if err := store.Save(cacheClient, found, found.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	var cached = store.CacheFirst(cacheClient, model, firstID.Hex()).(*testCampaign)
+	if cached.Clicks != 10 {
+		t.Errorf("cache first got %+v, want the saved clicks", cached)
+	}
+
+	if err := store.UpdateMany(model, bson.M{"site": "a"}, bson.M{"$inc": bson.M{"clicks": int32(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := store.Aggregate(model, &AggregateOpts{
+		Match:   bson.M{},
+		Project: []string{"site", "clicks"},
+		Group:   bson.M{"_id": "$site", "clicks": bson.M{"$sum": "$clicks"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var totals = make(map[string]int32)
+	for _, r := range results {
+		var doc = r.(bson.D).Map()
+		totals[doc["_id"].(string)] = doc["clicks"].(int32)
+	}
+	if totals["a"] != 14 || totals["b"] != 3 {
+		t.Errorf("aggregate got %v, want a:14 b:3", totals)
+	}
+
+	if !store.DeleteMany(model, bson.M{"site": "a"}) || store.CountDocs(model, bson.M{}) != 1 {
+		t.Errorf("delete many left %d documents", store.CountDocs(model, bson.M{}))
+	}
+	if single := store.FindByID(model, firstID.Hex()); single.Err() != mongo.ErrNoDocuments {
+		t.Errorf("find by id got %v, want no documents", single.Err())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/trustsignalio/golangutils/cache"
+	"github.com/trustsignalio/golangutils/mongodb"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -40,10 +41,7 @@ type AggregateOpts struct {
 
 // CountDocs method will count the documents in a table based on query supplied
 func CountDocs(db *mongo.Database, model Model, query bson.M) int64 {
-	var duration = time.Second
-	var opts = &options.CountOptions{MaxTime: &duration}
-	var result, _ = db.Collection(model.Table()).CountDocuments(context.Background(), query, opts)
-	return result
+	return NewStore(mongodb.NewDatabase(db)).CountDocs(model, query)
 }
 
 // NewMongoID method will return a new BSON Objec ID
@@ -73,27 +71,7 @@ func ConvertIDs(ids []string) []primitive.ObjectID {
 
 // Aggregate method will aggregate the collection and return the results accordingly
 func Aggregate(db *mongo.Database, model Model, extra *AggregateOpts) ([]interface{}, error) {
-	var opts = &options.AggregateOptions{MaxTime: &extra.MaxTime}
-	var pipeline []bson.M
-
-	project := bson.M{}
-	for _, p := range extra.Project {
-		project[p] = 1
-	}
-	pipeline = append(pipeline, bson.M{"$match": extra.Match})
-	pipeline = append(pipeline, bson.M{"$project": project})
-	pipeline = append(pipeline, bson.M{"$group": extra.Group})
-	if extra.Limit > 0 {
-		pipeline = append(pipeline, bson.M{"$limit": extra.Limit})
-	}
-	var cursor, err = db.Collection(model.Table()).Aggregate(context.Background(), pipeline, opts)
-
-	var results []interface{}
-	if err != nil {
-		return nil, err
-	}
-	err = cursor.All(context.Background(), &results)
-	return results, err
+	return NewStore(mongodb.NewDatabase(db)).Aggregate(model, extra)
 }
 
 // ToJSON method will convert the model to json string
@@ -107,82 +85,27 @@ func ToJSON(m Model) string {
 
 // FindOne method will try to find the object with given query
 func FindOne(db *mongo.Database, model Model, query bson.M) Model {
-	var duration = time.Second
-	var opts = &options.FindOneOptions{MaxTime: &duration}
-	var result = db.Collection(model.Table()).FindOne(context.Background(), query, opts)
-	if result.Err() == nil {
-		result.Decode(model)
-	}
-	return model
+	return NewStore(mongodb.NewDatabase(db)).FindOne(model, query)
 }
 
 // DeleteOne method will delete a single document based on the query
 func DeleteOne(db *mongo.Database, model Model, query bson.M) bool {
-	var opts = &options.DeleteOptions{}
-	var _, err = db.Collection(model.Table()).DeleteOne(context.Background(), query, opts)
-	if err == nil {
-		return true
-	}
-	return false
+	return NewStore(mongodb.NewDatabase(db)).DeleteOne(model, query)
 }
 
 // DeleteMany method will delete multiple documents based on the filter
 func DeleteMany(db *mongo.Database, model Model, query bson.M) bool {
-	var opts = &options.DeleteOptions{}
-	var _, err = db.Collection(model.Table()).DeleteMany(context.Background(), query, opts)
-	if err == nil {
-		return true
-	}
-	return false
+	return NewStore(mongodb.NewDatabase(db)).DeleteMany(model, query)
 }
 
 // FindAll will try to find the documents based on the query
 func FindAll(db *mongo.Database, model Model, query bson.M, queryOpts *FindOptions) []interface{} {
-	var duration = time.Second
-	var opts = &options.FindOptions{MaxTime: &duration}
-	if queryOpts != nil {
-		opts.Sort = queryOpts.Sort
-		opts.Hint = queryOpts.Hint
-		opts.Limit = queryOpts.Limit
-		opts.Skip = queryOpts.Skip
-		opts.Projection = queryOpts.Projection
-		if queryOpts.Timeout > 0 {
-			opts.MaxTime = &queryOpts.Timeout
-		}
-	}
-	var cur, err = db.Collection(model.Table()).Find(context.Background(), query, opts)
-	var dataArr []interface{}
-	if err != nil {
-		return dataArr
-	}
-	defer cur.Close(context.Background())
-	for cur.Next(context.Background()) {
-		var dummyObj = model.New()
-		err := cur.Decode(dummyObj)
-		if err == nil {
-			dataArr = append(dataArr, dummyObj)
-		}
-	}
-	return dataArr
+	return NewStore(mongodb.NewDatabase(db)).FindAll(model, query, queryOpts)
 }
 
 // FindOneWithOpts method will try to find the object based on the query and options
 func FindOneWithOpts(db *mongo.Database, model Model, query bson.M, queryOpts *FindOptions) Model {
-	var duration = time.Second
-	var opts = &options.FindOneOptions{MaxTime: &duration}
-	if queryOpts != nil {
-		opts.Sort = queryOpts.Sort
-		opts.Hint = queryOpts.Hint
-		opts.Skip = queryOpts.Skip
-		if queryOpts.Timeout > 0 {
-			opts.MaxTime = &queryOpts.Timeout
-		}
-	}
-	var result = db.Collection(model.Table()).FindOne(context.Background(), query, opts)
-	if result.Err() == nil {
-		result.Decode(model)
-	}
-	return model
+	return NewStore(mongodb.NewDatabase(db)).FindOneWithOpts(model, query, queryOpts)
 }
 
 func clearCache(cacheClient *cache.MultiClient, model Model, id string) {
@@ -192,59 +115,26 @@ func clearCache(cacheClient *cache.MultiClient, model Model, id string) {
 
 // Save method will save the document in db and update the cache
 func Save(db *mongo.Database, cacheClient *cache.MultiClient, model Model, id string) error {
-	var err error
-	if model.IsEmpty() {
-		_, err = db.Collection(model.Table()).InsertOne(context.Background(), model)
-	} else {
-		var upsert = true
-		var updateOpts = &options.UpdateOptions{Upsert: &upsert}
-		if len(id) == 24 {
-			oid := ConvertID(id)
-			_, err = db.Collection(model.Table()).UpdateOne(context.Background(), bson.M{"_id": oid}, bson.M{"$set": model}, updateOpts)
-		} else {
-			_, err = db.Collection(model.Table()).UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": model}, updateOpts)
-		}
-	}
-	clearCache(cacheClient, model, id)
-	model.ClearCacheData(cacheClient)
-	return err
+	return NewStore(mongodb.NewDatabase(db)).Save(cacheClient, model, id)
 }
 
 // Query method will return cursor to the database
 func Query(db *mongo.Database, model Model, query bson.M, queryOpts *FindOptions) (*mongo.Cursor, error) {
-	var duration = time.Second
-	var opts = &options.FindOptions{MaxTime: &duration}
+	var opts = findOptions(queryOpts)
 	if queryOpts != nil {
-		opts.Sort = queryOpts.Sort
-		opts.Hint = queryOpts.Hint
-		opts.Limit = queryOpts.Limit
-		opts.Skip = queryOpts.Skip
-		opts.BatchSize = queryOpts.BatchSize
-		if queryOpts.Timeout > 0 {
-			opts.MaxTime = &queryOpts.Timeout
-		}
+		opts.Projection = nil
 	}
 	return db.Collection(model.Table()).Find(context.Background(), query, opts)
 }
 
 // InsertMany method will insert documents in bulk inside the collection
 func InsertMany(db *mongo.Database, model Model, docs []interface{}) ([]interface{}, error) {
-	var ordered = false
-	opts := &options.InsertManyOptions{
-		Ordered: &ordered,
-	}
-	r, err := db.Collection(model.Table()).InsertMany(context.Background(), docs, opts)
-	if r != nil {
-		return r.InsertedIDs, err
-	}
-	return nil, err
+	return NewStore(mongodb.NewDatabase(db)).InsertMany(model, docs)
 }
 
 // UpdateMany will update the rows of the table based on the query supplied
 func UpdateMany(db *mongo.Database, model Model, query, updateObj bson.M) error {
-	var updateOpts = &options.UpdateOptions{}
-	_, err := db.Collection(model.Table()).UpdateMany(context.Background(), query, updateObj, updateOpts)
-	return err
+	return NewStore(mongodb.NewDatabase(db)).UpdateMany(model, query, updateObj)
 }
 
 // CacheFirst method will try to find the object with given id in cache else it
@@ -276,11 +166,5 @@ func GetCacheKey(model Model, id string) string {
 func FindByID(coll *mongo.Collection, id string) *mongo.SingleResult {
 	var duration = time.Second
 	var opts = &options.FindOneOptions{MaxTime: &duration}
-
-	var query = bson.M{"_id": id}
-	if len(id) == 24 {
-		query["_id"], _ = primitive.ObjectIDFromHex(id)
-	}
-	var result = coll.FindOne(context.Background(), query, opts)
-	return result
+	return coll.FindOne(context.Background(), idQuery(id), opts)
 }
@@ -0,0 +1,322 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultWatchBuffer = 100
+const defaultWatchRetryInterval = time.Second
+const defaultWatchMaxRetryInterval = time.Minute
+
+// error codes returned by the server when the resume token is no longer in the oplog
+const changeStreamHistoryLost = 286
+const changeStreamFatalError = 280
+
+// ErrNoHandler is returned when Watch is called without a handler
+var ErrNoHandler = errors.New("mongodb: change handler is required")
+
+// ChangeEvent struct contains a single event received from the change stream
+type ChangeEvent struct {
+	ResumeToken   bson.Raw            `bson:"_id"`
+	OperationType string              `bson:"operationType"`
+	FullDocument  bson.Raw            `bson:"fullDocument"`
+	DocumentKey   bson.M              `bson:"documentKey"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	Namespace     struct {
+		Database   string `bson:"db"`
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	UpdateDescription *struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// ChangeHandler is called for every event in order, the next event is not
+// delivered until the handler returns. If an error is returned the stream is
+// restarted from the last successfully handled event, the event is skipped
+// after WatchOptions.MaxAttempts failures
+type ChangeHandler func(ctx context.Context, event *ChangeEvent) error
+
+// TokenStore interface persists the resume token so that the watcher can
+// continue from the last handled event after a restart
+type TokenStore interface {
+	Load(ctx context.Context) (bson.Raw, error)
+	Save(ctx context.Context, token bson.Raw) error
+}
+
+// WatchOptions struct contains the options for watching the change stream
+type WatchOptions struct {
+	Collection    string         // empty string watches the whole database
+	Pipeline      mongo.Pipeline // filters applied on the server eg: $match on operationType
+	FullDocument  bool           // lookup the current document for update events
+	TokenStore    TokenStore
+	BufferSize    int // events read ahead of the handler before the stream is paused
+	RetryInterval time.Duration
+	MaxRetry      time.Duration // max wait between retries, the wait is doubled on each failure
+	OnError       func(error)
+	// MaxAttempts is the number of times the handler is tried for an event
+	// before it is passed to OnSkip and skipped, zero retries it forever
+	MaxAttempts int
+	OnSkip      func(event *ChangeEvent, err error) // eg: save the event in a dead letter collection
+}
+
+// handlerFailures counts the failed attempts of the event being retried
+type handlerFailures struct {
+	token    string
+	attempts int
+}
+
+// FileTokenStore saves the resume token in a file on disk
+type FileTokenStore struct {
+	Path string
+}
+
+// MongoTokenStore saves the resume token in a document of a collection
+type MongoTokenStore struct {
+	coll *mongo.Collection
+	id   string
+}
+
+type tokenDoc struct {
+	Token bson.Raw `bson:"token"`
+}
+
+// NewFileTokenStore method will return a token store which writes to the path
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+// Load method will read the token from the file, a missing file returns nil token
+func (s *FileTokenStore) Load(ctx context.Context) (bson.Raw, error) {
+	var data, err = ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return bson.Raw(data), bson.Raw(data).Validate()
+}
+
+// Save method will write the token to a temp file and rename it into place so
+// that a crash never leaves a partially written token
+func (s *FileTokenStore) Save(ctx context.Context, token bson.Raw) error {
+	var tmp, err = ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(token); err == nil {
+		// the data must be on disk before the rename else a crash can leave an empty file
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), s.Path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(s.Path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// NewMongoTokenStore method will return a token store which saves the token
+// in the document with given id inside the collection
+func NewMongoTokenStore(db *mongo.Database, collection, id string) *MongoTokenStore {
+	return &MongoTokenStore{coll: db.Collection(collection), id: id}
+}
+
+// Load method will find the token document, a missing document returns nil token
+func (s *MongoTokenStore) Load(ctx context.Context) (bson.Raw, error) {
+	var doc tokenDoc
+	var err = s.coll.FindOne(ctx, bson.M{"_id": s.id}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return doc.Token, err
+}
+
+// Save method will upsert the token document
+func (s *MongoTokenStore) Save(ctx context.Context, token bson.Raw) error {
+	var update = bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}}
+	var _, err = s.coll.UpdateOne(ctx, bson.M{"_id": s.id}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// Watch method will subscribe to the change stream of the collection or database
+// and deliver the events to the handler. Errors are reported to OnError and the
+// stream is resumed from the last saved token. It blocks till the context is done
+func (c *Client) Watch(ctx context.Context, opts *WatchOptions, handler ChangeHandler) error {
+	if handler == nil {
+		return ErrNoHandler
+	}
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	var interval = opts.RetryInterval
+	if interval == 0 {
+		interval = defaultWatchRetryInterval
+	}
+	var maxInterval = opts.MaxRetry
+	if maxInterval == 0 {
+		maxInterval = defaultWatchMaxRetryInterval
+	}
+
+	var token bson.Raw
+	if opts.TokenStore != nil {
+		var err error
+		if token, err = opts.TokenStore.Load(ctx); err != nil {
+			return err
+		}
+	}
+
+	var wait = interval
+	var failures = &handlerFailures{}
+	for {
+		var progressed bool
+		var err error
+		token, progressed, err = c.watchStream(ctx, opts, token, handler, failures)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && opts.OnError != nil {
+			opts.OnError(err)
+		}
+		if isHistoryLost(err) {
+			token = nil // token is no longer in the oplog so start from now
+		}
+		if progressed {
+			wait = interval
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if wait *= 2; wait > maxInterval {
+			wait = maxInterval
+		}
+	}
+}
+
+// watchStream reads the stream in a goroutine which blocks on the buffered
+// channel when the handler falls behind, it returns the last handled token
+func (c *Client) watchStream(ctx context.Context, opts *WatchOptions, token bson.Raw, handler ChangeHandler, failures *handlerFailures) (bson.Raw, bool, error) {
+	var csOpts = options.ChangeStream()
+	if opts.FullDocument {
+		csOpts.SetFullDocument(options.UpdateLookup)
+	}
+	if token != nil {
+		csOpts.SetResumeAfter(token)
+	}
+	var pipeline = opts.Pipeline
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	var stream *mongo.ChangeStream
+	var err error
+	if opts.Collection != "" {
+		stream, err = c.db.Collection(opts.Collection).Watch(streamCtx, pipeline, csOpts)
+	} else {
+		stream, err = c.db.Watch(streamCtx, pipeline, csOpts)
+	}
+	if err != nil {
+		cancel()
+		return token, false, err
+	}
+
+	var bufferSize = opts.BufferSize
+	if bufferSize == 0 {
+		bufferSize = defaultWatchBuffer
+	}
+	var events = make(chan *ChangeEvent, bufferSize)
+	var readErr = make(chan error, 1)
+	go func() {
+		defer close(events)
+		for stream.Next(streamCtx) {
+			var e = &ChangeEvent{}
+			if err := stream.Decode(e); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case events <- e:
+			case <-streamCtx.Done():
+				readErr <- streamCtx.Err()
+				return
+			}
+		}
+		readErr <- stream.Err()
+	}()
+	// the stream must not be closed while the reader goroutine is using it
+	defer func() {
+		cancel()
+		for range events {
+		}
+		stream.Close(context.Background())
+	}()
+
+	var progressed bool
+	for e := range events {
+		if err := handler(ctx, e); err != nil && !failures.skip(opts, e, err) {
+			return token, progressed, err
+		}
+		token = e.ResumeToken
+		progressed = true
+		if opts.TokenStore != nil {
+			if err := opts.TokenStore.Save(ctx, token); err != nil {
+				return token, progressed, err
+			}
+		}
+	}
+	return token, progressed, <-readErr
+}
+
+// skip records the failed attempt of the event and returns true once the event
+// has failed MaxAttempts times, the event is then passed to OnSkip
+func (f *handlerFailures) skip(opts *WatchOptions, e *ChangeEvent, err error) bool {
+	if opts.MaxAttempts <= 0 {
+		return false
+	}
+	if string(e.ResumeToken) != f.token {
+		f.token, f.attempts = string(e.ResumeToken), 0
+	}
+	if f.attempts++; f.attempts < opts.MaxAttempts {
+		return false
+	}
+	f.token, f.attempts = "", 0
+	if opts.OnSkip != nil {
+		opts.OnSkip(e, err)
+	}
+	return true
+}
+
+func isHistoryLost(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code == changeStreamHistoryLost || cmdErr.Code == changeStreamFatalError
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestHandlerFailuresSkip(t *testing.T) {
+	var skipped []string
+	var opts = &WatchOptions{MaxAttempts: 3, OnSkip: func(e *ChangeEvent, err error) {
+		skipped = append(skipped, string(e.ResumeToken))
+	}}
+	var failures = &handlerFailures{}
+	var first = &ChangeEvent{ResumeToken: bson.Raw("a")}
+	var second = &ChangeEvent{ResumeToken: bson.Raw("b")}
+	var handlerErr = errors.New("handler failed")
+
+	var got []bool
+	for _, e := range []*ChangeEvent{first, first, second, second, second, first} {
+		got = append(got, failures.skip(opts, e, handlerErr))
+	}
+	// the attempts of an event start again when another event fails
+	var want = []bool{false, false, false, false, true, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if len(skipped) != 1 || skipped[0] != "b" {
+		t.Errorf("got %v skipped, want b", skipped)
+	}
+
+	if (&handlerFailures{}).skip(&WatchOptions{}, first, handlerErr) {
+		t.Error("events must be retried forever without MaxAttempts")
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	var ctx = context.Background()
+	var store = NewFileTokenStore(filepath.Join(t.TempDir(), "token"))
+	if token, err := store.Load(ctx); token != nil || err != nil {
+		t.Fatalf("missing file got %v %v, want no token", token, err)
+	}
+
+	var token, _ = bson.Marshal(bson.M{"_data": "8263"})
+	if err := store.Save(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	var loaded, err = store.Load(ctx)
+	if err != nil || string(loaded) != string(token) {
+		t.Errorf("got %v %v, want the saved token", loaded, err)
+	}
+	var files, _ = ioutil.ReadDir(filepath.Dir(store.Path))
+	if len(files) != 1 {
+		t.Errorf("got %d files, want the temp file renamed", len(files))
+	}
+
+	if err := ioutil.WriteFile(store.Path, []byte("not bson"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx); err == nil {
+		t.Error("want an error for a corrupt token")
+	}
+}
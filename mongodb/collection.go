@@ -0,0 +1,91 @@
+package mongodb
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Database interface covers the subset of *mongo.Database used by the library
+// so that the code can be tested against the in-memory implementation in memdb
+type Database interface {
+	Name() string
+	Collection(name string) Collection
+}
+
+// Collection interface covers the operations done by the models on a collection
+type Collection interface {
+	Name() string
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) SingleResult
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (Cursor, error)
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
+	UpdateOne(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error)
+}
+
+// Cursor interface is satisfied by *mongo.Cursor
+type Cursor interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	All(ctx context.Context, results interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// SingleResult interface is satisfied by *mongo.SingleResult
+type SingleResult interface {
+	Err() error
+	Decode(v interface{}) error
+}
+
+type mongoDatabase struct {
+	db *mongo.Database
+}
+
+type mongoCollection struct {
+	*mongo.Collection
+}
+
+// NewDatabase method will wrap the driver database in the Database interface
+func NewDatabase(db *mongo.Database) Database {
+	return &mongoDatabase{db: db}
+}
+
+// Database method will return the database of the client as Database interface
+func (c *Client) Database() Database {
+	return NewDatabase(c.db)
+}
+
+func (d *mongoDatabase) Name() string {
+	return d.db.Name()
+}
+
+func (d *mongoDatabase) Collection(name string) Collection {
+	return &mongoCollection{d.db.Collection(name)}
+}
+
+func (c *mongoCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) SingleResult {
+	return c.Collection.FindOne(ctx, filter, opts...)
+}
+
+func (c *mongoCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (Cursor, error) {
+	var cursor, err = c.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+func (c *mongoCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error) {
+	var cursor, err = c.Collection.Aggregate(ctx, pipeline, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
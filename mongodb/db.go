@@ -2,12 +2,17 @@ package mongodb
 
 import (
 	"context"
+	"sync"
 	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const defaultPingTimeout = 2 * time.Second
+
 type Config struct {
 	AuthSource string
 	Username   string
@@ -15,24 +20,76 @@ type Config struct {
 	Opts       string
 	Database   string
 	Hosts      []string
+
+	// HealthInterval enables the background health monitor when greater
+	// than zero, the deployment will be pinged after every interval
+	HealthInterval time.Duration
+	PingTimeout    time.Duration
+	// OnHealthChange is called whenever the topology changes or the result
+	// of the health check flips between success and failure, it runs on its
+	// own goroutine and only the latest status is delivered when it falls behind
+	OnHealthChange func(Health)
+	// Transaction contains the default options used by WithTransaction
+	Transaction *TransactionOptions
+	// Monitor enables the command monitoring with per collection stats
+	Monitor *MonitorOptions
 }
 
 type Client struct {
 	mclient *mongo.Client
 	db      *mongo.Database
+
+	pingTimeout    time.Duration
+	onHealthChange func(Health)
+	healthMu       sync.RWMutex
+	// healthMonitored is true when the background health monitor is running
+	healthMonitored bool
+	health          Health
+	// healthChan hands the changes to the OnHealthChange dispatcher
+	healthChan chan Health
+	quitChan   chan bool
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+	txnOpts    *TransactionOptions
+	monitor    *commandMonitor
 }
 
 // NewClient method takes a config map argument
 func NewClient(conf Config, connnectionStr string) (*Client, error) {
-	var client = &Client{}
+	var client = &Client{pingTimeout: conf.PingTimeout, onHealthChange: conf.OnHealthChange, txnOpts: conf.Transaction, quitChan: make(chan bool)}
+	if client.pingTimeout == 0 {
+		client.pingTimeout = defaultPingTimeout
+	}
+	if client.onHealthChange != nil {
+		// the topology events come in while connecting so the dispatcher runs first
+		client.healthChan = make(chan Health, 1)
+		client.wg.Add(1)
+		go client.dispatchHealth()
+	}
+	var clientOpts = options.Client().ApplyURI(connnectionStr)
+	clientOpts.SetServerMonitor(&event.ServerMonitor{
+		TopologyDescriptionChanged: client.topologyChanged,
+	})
+	if conf.Monitor != nil {
+		client.monitor = newCommandMonitor(conf.Monitor)
+		clientOpts.SetMonitor(client.monitor.eventMonitor())
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	mclient, err := mongo.Connect(ctx, options.Client().ApplyURI(connnectionStr))
+	mclient, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
+		client.stop()
 		return nil, err
 	}
 	client.mclient = mclient
 	client.db = mclient.Database(conf.Database)
+
+	if conf.HealthInterval > 0 {
+		client.healthMonitored = true
+		client.wg.Add(1)
+		go client.monitorHealth(conf.HealthInterval)
+	}
 	return client, nil
 }
 
@@ -40,8 +97,32 @@ func (c *Client) GetDb() *mongo.Database {
 	return c.db
 }
 
+// Ping method will ping the primary with the configured ping timeout
 func (c *Client) Ping() error {
-	return c.mclient.Ping(context.TODO(), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), c.pingTimeout)
+	defer cancel()
+	return c.PingContext(ctx)
+}
+
+// PingContext method will ping the primary and return as soon as the
+// context is cancelled or expires
+func (c *Client) PingContext(ctx context.Context) error {
+	return c.mclient.Ping(ctx, nil)
+}
+
+// Close method will stop the health monitor and disconnect the client,
+// the pending operations are given time till the context expires
+func (c *Client) Close(ctx context.Context) error {
+	c.stop()
+	return c.mclient.Disconnect(ctx)
+}
+
+// stop ends the background goroutines, it is safe to call more than once
+func (c *Client) stop() {
+	c.closeOnce.Do(func() {
+		close(c.quitChan)
+		c.wg.Wait()
+	})
 }
 
 func (c *Client) GenerateID() primitive.ObjectID {
@@ -0,0 +1,131 @@
+package mongodb
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+// Health struct contains the last known state of the deployment, it is
+// meant to be used by the readiness endpoints of the services
+type Health struct {
+	Healthy          bool
+	LastPing         time.Time // time of the last successful ping
+	LastPingLatency  time.Duration
+	LastError        error
+	Topology         string
+	PrimaryAvailable bool
+	Secondaries      int
+	Servers          int
+}
+
+// Health method will return a copy of the current health status of the client
+func (c *Client) Health() Health {
+	c.healthMu.RLock()
+	defer c.healthMu.RUnlock()
+	return c.health
+}
+
+// IsReady method will return true if the last health check was successful
+// and a primary is available for writes. The deployment is pinged on every
+// call when the health monitor is disabled since no check runs in the background
+func (c *Client) IsReady() bool {
+	if !c.healthMonitored {
+		c.checkHealth()
+	}
+	var h = c.Health()
+	return h.Healthy && h.PrimaryAvailable
+}
+
+func (c *Client) monitorHealth(interval time.Duration) {
+	defer c.wg.Done()
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	c.checkHealth()
+	for {
+		select {
+		case <-ticker.C:
+			c.checkHealth()
+		case <-c.quitChan:
+			return
+		}
+	}
+}
+
+func (c *Client) checkHealth() {
+	var start = time.Now()
+	var err = c.Ping()
+	var latency = time.Since(start)
+
+	c.healthMu.Lock()
+	var changed = c.health.Healthy != (err == nil)
+	c.health.Healthy = err == nil
+	c.health.LastError = err
+	if err == nil {
+		c.health.LastPing = start
+		c.health.LastPingLatency = latency
+	}
+	var h = c.health
+	c.healthMu.Unlock()
+
+	if changed {
+		c.notifyHealth(h)
+	}
+}
+
+// topologyChanged is called by the driver with the topology lock held so the
+// OnHealthChange callback is left to the dispatcher goroutine
+func (c *Client) topologyChanged(e *event.TopologyDescriptionChangedEvent) {
+	var topology = e.NewDescription
+	var secondaries int
+	for _, s := range topology.Servers {
+		if s.Kind == description.RSSecondary {
+			secondaries++
+		}
+	}
+
+	c.healthMu.Lock()
+	c.health.Topology = topology.Kind.String()
+	c.health.PrimaryAvailable = topology.HasWritableServer()
+	c.health.Secondaries = secondaries
+	c.health.Servers = len(topology.Servers)
+	var h = c.health
+	c.healthMu.Unlock()
+
+	c.notifyHealth(h)
+}
+
+// notifyHealth hands the status to the dispatcher without blocking, a status
+// which was not delivered yet is replaced by the newer one
+func (c *Client) notifyHealth(h Health) {
+	if c.healthChan == nil {
+		return
+	}
+	for {
+		select {
+		case c.healthChan <- h:
+			return
+		default:
+		}
+		select {
+		case <-c.healthChan:
+		default:
+		}
+	}
+}
+
+// dispatchHealth runs the OnHealthChange callback outside the driver so a slow
+// callback or one using the client does not hold up the server selection
+func (c *Client) dispatchHealth() {
+	defer c.wg.Done()
+	for {
+		select {
+		case h := <-c.healthChan:
+			c.onHealthChange(h)
+		case <-c.quitChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec struct declares a single index which should exist on a collection
+type IndexSpec struct {
+	Collection    string
+	Name          string // generated from the keys when empty eg: "site_1_created_-1"
+	Keys          bson.D
+	Unique        bool
+	PartialFilter bson.M
+	TTL           time.Duration
+	Collation     *options.Collation
+}
+
+// IndexedModel interface can be implemented by the models which want to
+// declare their indexes next to the Table() method
+type IndexedModel interface {
+	Table() string
+	Indexes() []IndexSpec
+}
+
+// ExistingIndex struct contains the information of an index returned by listIndexes
+type ExistingIndex struct {
+	Collection    string
+	Name          string `bson:"name"`
+	Keys          bson.D `bson:"key"`
+	Unique        bool   `bson:"unique"`
+	ExpireAfter   *int32 `bson:"expireAfterSeconds"`
+	PartialFilter bson.M `bson:"partialFilterExpression"`
+	Collation     bson.M `bson:"collation"` // nil when the index has no collation
+}
+
+// IndexDiff struct contains the difference between the declared indexes and
+// the indexes present in the database
+type IndexDiff struct {
+	Missing    []IndexSpec
+	Mismatched []IndexSpec     // index with same name exists but the definition differs
+	Unexpected []ExistingIndex // index exists in db but is not declared
+	// Conflicting are the declared indexes whose keys are already indexed
+	// under another name, creating them fails with IndexOptionsConflict
+	Conflicting []IndexConflict
+}
+
+// IndexConflict struct contains the declared index and the existing index
+// which has the same keys under a different name
+type IndexConflict struct {
+	Spec     IndexSpec
+	Existing ExistingIndex
+}
+
+// SyncOptions struct contains the options for syncing the indexes
+type SyncOptions struct {
+	DropUnexpected bool // drop the indexes which are not declared
+	// DropMismatched drops and creates again the indexes whose definition
+	// differs, the conflicting indexes are renamed the same way
+	DropMismatched bool
+	DryRun         bool // only report the diff without changing anything
+	MaxTime        time.Duration
+}
+
+// IndexName method will return the name of the index, if no name is given then
+// it will be generated the same way as mongo does it
+func (s IndexSpec) IndexName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	var parts []string
+	for _, k := range s.Keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (s IndexSpec) model() mongo.IndexModel {
+	var opts = options.Index().SetName(s.IndexName())
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+	if s.PartialFilter != nil {
+		opts.SetPartialFilterExpression(s.PartialFilter)
+	}
+	if s.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(s.TTL / time.Second))
+	}
+	if s.Collation != nil {
+		opts.SetCollation(s.Collation)
+	}
+	return mongo.IndexModel{Keys: s.Keys, Options: opts}
+}
+
+// matches compares the definition of the declared index with the existing
+// one, the documents are normalised since the server returns the numbers as
+// int32 or double and fills the defaults of the collation
+func (s IndexSpec) matches(e ExistingIndex) bool {
+	if s.Unique != e.Unique || !s.sameKeys(e) {
+		return false
+	}
+	var ttl int32
+	if e.ExpireAfter != nil {
+		ttl = *e.ExpireAfter
+	}
+	if int32(s.TTL/time.Second) != ttl {
+		return false
+	}
+	if (s.PartialFilter != nil) != (e.PartialFilter != nil) {
+		return false
+	}
+	if s.PartialFilter != nil && !reflect.DeepEqual(normaliseValue(s.PartialFilter), normaliseValue(e.PartialFilter)) {
+		return false
+	}
+	return s.sameCollation(e)
+}
+
+func (s IndexSpec) sameKeys(e ExistingIndex) bool {
+	if len(s.Keys) != len(e.Keys) {
+		return false
+	}
+	for i, k := range s.Keys {
+		if k.Key != e.Keys[i].Key || !sameKeyValue(k.Value, e.Keys[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// collationDefaults are the values filled by the server for the fields which
+// are not given when the index is created
+var collationDefaults = bson.M{
+	"caseLevel":       false,
+	"caseFirst":       "off",
+	"strength":        3,
+	"numericOrdering": false,
+	"alternate":       "non-ignorable",
+	"maxVariable":     "punct",
+	"normalization":   false,
+	"backwards":       false,
+}
+
+// sameCollation compares every field of the collation except the ICU version,
+// the simple locale is the same as no collation
+func (s IndexSpec) sameCollation(e ExistingIndex) bool {
+	var declared = s.Collation != nil && s.Collation.Locale != "simple"
+	if !declared || e.Collation == nil {
+		return !declared && e.Collation == nil
+	}
+	var expected = bson.M{}
+	for k, v := range collationDefaults {
+		expected[k] = v
+	}
+	var given bson.M
+	if err := bson.Unmarshal(s.Collation.ToDocument(), &given); err != nil {
+		return false
+	}
+	for k, v := range given {
+		expected[k] = v
+	}
+	var existing = e.Collation
+	for k, v := range expected {
+		actual, ok := existing[k]
+		if !ok {
+			// older servers do not return every field
+			continue
+		}
+		if !reflect.DeepEqual(normaliseValue(v), normaliseValue(actual)) {
+			return false
+		}
+	}
+	return existing["locale"] == s.Collation.Locale
+}
+
+// normaliseValue converts the documents to maps and the numbers to float64 so
+// that the values decoded from the server can be compared with the declared ones
+func normaliseValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case bson.M:
+		var m = make(map[string]interface{}, len(value))
+		for k, item := range value {
+			m[k] = normaliseValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		return normaliseValue(bson.M(value))
+	case bson.D:
+		var m = make(map[string]interface{}, len(value))
+		for _, item := range value {
+			m[item.Key] = normaliseValue(item.Value)
+		}
+		return m
+	case bson.A:
+		return normaliseValue([]interface{}(value))
+	case []interface{}:
+		var a = make([]interface{}, len(value))
+		for i, item := range value {
+			a[i] = normaliseValue(item)
+		}
+		return a
+	case int:
+		return float64(value)
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case float32:
+		return float64(value)
+	case primitive.Decimal128:
+		return value.String()
+	case time.Time:
+		return primitive.NewDateTimeFromTime(value)
+	}
+	// the other types eg: structs are compared by their bson form
+	var rv = reflect.ValueOf(v)
+	if rv.Kind() == reflect.Struct || (rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct) {
+		if _, ok := v.(primitive.ObjectID); !ok {
+			var doc bson.M
+			if data, err := bson.Marshal(v); err == nil && bson.Unmarshal(data, &doc) == nil {
+				return normaliseValue(doc)
+			}
+		}
+	}
+	return v
+}
+
+// sameKeyValue compares the index key direction or type, numbers are returned
+// by the server as int32 or double irrespective of how they were declared
+func sameKeyValue(a, b interface{}) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// GetModelIndexes method will return the index specs declared by the models
+// with collection name filled from the Table() method
+func GetModelIndexes(models ...IndexedModel) []IndexSpec {
+	var specs []IndexSpec
+	for _, m := range models {
+		for _, s := range m.Indexes() {
+			if s.Collection == "" {
+				s.Collection = m.Table()
+			}
+			specs = append(specs, s)
+		}
+	}
+	return specs
+}
+
+// ListIndexes method will return all the indexes of the collection except
+// the default _id index
+func (c *Client) ListIndexes(ctx context.Context, collection string) ([]ExistingIndex, error) {
+	var cursor, err = c.db.Collection(collection).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []ExistingIndex
+	for cursor.Next(ctx) {
+		var idx ExistingIndex
+		if err := cursor.Decode(&idx); err != nil {
+			return nil, err
+		}
+		if idx.Name == "_id_" {
+			continue
+		}
+		idx.Collection = collection
+		result = append(result, idx)
+	}
+	return result, cursor.Err()
+}
+
+// DiffIndexes method will compare the declared specs with the indexes present
+// in the database, only the collections present in specs are checked
+func (c *Client) DiffIndexes(ctx context.Context, specs []IndexSpec) (*IndexDiff, error) {
+	var diff = &IndexDiff{}
+	var byCollection = make(map[string][]IndexSpec)
+	var collections []string
+	for _, s := range specs {
+		if _, ok := byCollection[s.Collection]; !ok {
+			collections = append(collections, s.Collection)
+		}
+		byCollection[s.Collection] = append(byCollection[s.Collection], s)
+	}
+
+	for _, coll := range collections {
+		existing, err := c.ListIndexes(ctx, coll)
+		if err != nil {
+			return nil, err
+		}
+		var existingByName = make(map[string]ExistingIndex)
+		for _, e := range existing {
+			existingByName[e.Name] = e
+		}
+		var declared = make(map[string]bool)
+		for _, s := range byCollection[coll] {
+			var name = s.IndexName()
+			declared[name] = true
+			e, found := existingByName[name]
+			if !found {
+				if conflict, ok := findConflict(s, existing); ok {
+					declared[conflict.Name] = true
+					diff.Conflicting = append(diff.Conflicting, IndexConflict{Spec: s, Existing: conflict})
+				} else {
+					diff.Missing = append(diff.Missing, s)
+				}
+			} else if !s.matches(e) {
+				diff.Mismatched = append(diff.Mismatched, s)
+			}
+		}
+		for _, e := range existing {
+			if !declared[e.Name] {
+				diff.Unexpected = append(diff.Unexpected, e)
+			}
+		}
+	}
+	return diff, nil
+}
+
+// findConflict returns the existing index with the same keys and collation,
+// the server does not allow two such indexes with different names
+func findConflict(s IndexSpec, existing []ExistingIndex) (ExistingIndex, bool) {
+	for _, e := range existing {
+		if e.Name != s.IndexName() && s.sameKeys(e) && s.sameCollation(e) {
+			return e, true
+		}
+	}
+	return ExistingIndex{}, false
+}
+
+// SyncIndexes method will create the missing indexes and optionally drop the
+// unexpected or mismatched ones, the diff computed before syncing is returned
+func (c *Client) SyncIndexes(ctx context.Context, specs []IndexSpec, opts *SyncOptions) (*IndexDiff, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	var diff, err = c.DiffIndexes(ctx, specs)
+	if err != nil || opts.DryRun {
+		return diff, err
+	}
+	var createOpts = options.CreateIndexes()
+	var dropOpts = options.DropIndexes()
+	if opts.MaxTime > 0 {
+		createOpts.SetMaxTime(opts.MaxTime)
+		dropOpts.SetMaxTime(opts.MaxTime)
+	}
+
+	var toCreate = append([]IndexSpec{}, diff.Missing...)
+	if opts.DropMismatched {
+		for _, s := range diff.Mismatched {
+			if _, err := c.db.Collection(s.Collection).Indexes().DropOne(ctx, s.IndexName(), dropOpts); err != nil {
+				return diff, err
+			}
+			toCreate = append(toCreate, s)
+		}
+		for _, conflict := range diff.Conflicting {
+			var existing = conflict.Existing
+			if _, err := c.db.Collection(existing.Collection).Indexes().DropOne(ctx, existing.Name, dropOpts); err != nil {
+				return diff, err
+			}
+			toCreate = append(toCreate, conflict.Spec)
+		}
+	}
+	if opts.DropUnexpected {
+		for _, e := range diff.Unexpected {
+			if _, err := c.db.Collection(e.Collection).Indexes().DropOne(ctx, e.Name, dropOpts); err != nil {
+				return diff, err
+			}
+		}
+	}
+	for _, s := range toCreate {
+		if _, err := c.db.Collection(s.Collection).Indexes().CreateOne(ctx, s.model(), createOpts); err != nil {
+			return diff, err
+		}
+	}
+	return diff, nil
+}
+
+// SyncModelIndexes method will sync the indexes declared by the models
+func (c *Client) SyncModelIndexes(ctx context.Context, opts *SyncOptions, models ...IndexedModel) (*IndexDiff, error) {
+	return c.SyncIndexes(ctx, GetModelIndexes(models...), opts)
+}
@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func int32Ptr(v int32) *int32 {
+	return &v
+}
+
+// serverCollation is the collation document listIndexes returns for the en
+// locale with strength 2, the server fills every field and the ICU version
+func serverCollation() bson.M {
+	return bson.M{
+		"locale": "en", "caseLevel": false, "caseFirst": "off", "strength": int32(2),
+		"numericOrdering": false, "alternate": "non-ignorable", "maxVariable": "punct",
+		"normalization": false, "backwards": false, "version": "57.1",
+	}
+}
+
+func TestIndexSpecMatches(t *testing.T) {
+	var keys = bson.D{{Key: "site", Value: 1}, {Key: "created", Value: -1}}
+	var existingKeys = bson.D{{Key: "site", Value: int32(1)}, {Key: "created", Value: int32(-1)}}
+	var tests = []struct {
+		name     string
+		spec     IndexSpec
+		existing ExistingIndex
+		want     bool
+	}{
+		{"same keys", IndexSpec{Keys: keys}, ExistingIndex{Keys: existingKeys}, true},
+		{"keys returned as double", IndexSpec{Keys: keys}, ExistingIndex{Keys: bson.D{{Key: "site", Value: 1.0}, {Key: "created", Value: -1.0}}}, true},
+		{"keys in another order", IndexSpec{Keys: keys}, ExistingIndex{Keys: bson.D{existingKeys[1], existingKeys[0]}}, false},
+		{"direction differs", IndexSpec{Keys: keys}, ExistingIndex{Keys: bson.D{existingKeys[0], {Key: "created", Value: int32(1)}}}, false},
+		{"text index", IndexSpec{Keys: bson.D{{Key: "title", Value: "text"}}}, ExistingIndex{Keys: bson.D{{Key: "title", Value: "text"}}}, true},
+		{"unique differs", IndexSpec{Keys: keys, Unique: true}, ExistingIndex{Keys: existingKeys}, false},
+		{"same ttl", IndexSpec{Keys: keys, TTL: time.Hour}, ExistingIndex{Keys: existingKeys, ExpireAfter: int32Ptr(3600)}, true},
+		{"ttl differs", IndexSpec{Keys: keys, TTL: time.Hour}, ExistingIndex{Keys: existingKeys, ExpireAfter: int32Ptr(60)}, false},
+		{"ttl missing", IndexSpec{Keys: keys, TTL: time.Hour}, ExistingIndex{Keys: existingKeys}, false},
+		{"partial filter with other number types",
+			IndexSpec{Keys: keys, PartialFilter: bson.M{"clicks": bson.M{"$gt": 10}}},
+			ExistingIndex{Keys: existingKeys, PartialFilter: bson.M{"clicks": bson.D{{Key: "$gt", Value: int32(10)}}}}, true},
+		{"partial filter differs",
+			IndexSpec{Keys: keys, PartialFilter: bson.M{"clicks": bson.M{"$gt": 10}}},
+			ExistingIndex{Keys: existingKeys, PartialFilter: bson.M{"clicks": bson.M{"$gt": int32(5)}}}, false},
+		{"partial filter missing", IndexSpec{Keys: keys, PartialFilter: bson.M{"active": true}}, ExistingIndex{Keys: existingKeys}, false},
+		{"partial filter not declared", IndexSpec{Keys: keys}, ExistingIndex{Keys: existingKeys, PartialFilter: bson.M{"active": true}}, false},
+		{"collation filled by the server",
+			IndexSpec{Keys: keys, Collation: &options.Collation{Locale: "en", Strength: 2}},
+			ExistingIndex{Keys: existingKeys, Collation: serverCollation()}, true},
+		{"collation differs", IndexSpec{Keys: keys, Collation: &options.Collation{Locale: "en", Strength: 1}},
+			ExistingIndex{Keys: existingKeys, Collation: serverCollation()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.spec.matches(tt.existing); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSpecSameCollation(t *testing.T) {
+	var tests = []struct {
+		name      string
+		collation *options.Collation
+		existing  bson.M
+		want      bool
+	}{
+		{"none", nil, nil, true},
+		{"simple locale is no collation", &options.Collation{Locale: "simple"}, nil, true},
+		{"declared but missing", &options.Collation{Locale: "en"}, nil, false},
+		{"not declared but present", nil, serverCollation(), false},
+		{"defaults filled by the server", &options.Collation{Locale: "en", Strength: 2}, serverCollation(), true},
+		{"locale differs", &options.Collation{Locale: "fr", Strength: 2}, serverCollation(), false},
+		{"default strength differs", &options.Collation{Locale: "en"}, serverCollation(), false},
+		{"option differs from the default", &options.Collation{Locale: "en", Strength: 2, NumericOrdering: true}, serverCollation(), false},
+		{"older server without every field", &options.Collation{Locale: "en", Strength: 2}, bson.M{"locale": "en", "strength": 2.0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spec = IndexSpec{Collation: tt.collation}
+			if got := spec.sameCollation(ExistingIndex{Collation: tt.existing}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormaliseValue(t *testing.T) {
+	var now = time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"int", 5, 5.0},
+		{"int32", int32(5), 5.0},
+		{"int64", int64(5), 5.0},
+		{"float32", float32(0.5), 0.5},
+		{"string", "a", "a"},
+		{"time", now, primitive.NewDateTimeFromTime(now)},
+		{"document", bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: bson.A{int64(2), "x"}}},
+			map[string]interface{}{"a": 1.0, "b": []interface{}{2.0, "x"}}},
+		{"map", map[string]interface{}{"a": bson.M{"b": 1}}, map[string]interface{}{"a": map[string]interface{}{"b": 1.0}}},
+		{"struct", struct {
+			Site string `bson:"site"`
+		}{"a"}, map[string]interface{}{"site": "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normaliseValue(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	var id = primitive.NewObjectID()
+	if got := normaliseValue(id); got != id {
+		t.Errorf("object id got %#v, want it unchanged", got)
+	}
+}
+
+func TestFindConflict(t *testing.T) {
+	var spec = IndexSpec{Name: "by_site", Keys: bson.D{{Key: "site", Value: 1}}}
+	var existing = []ExistingIndex{
+		{Name: "created_1", Keys: bson.D{{Key: "created", Value: int32(1)}}},
+		{Name: "site_1", Keys: bson.D{{Key: "site", Value: int32(1)}}},
+	}
+	if conflict, ok := findConflict(spec, existing); !ok || conflict.Name != "site_1" {
+		t.Errorf("got %v %v, want site_1", conflict.Name, ok)
+	}
+	spec.Collation = &options.Collation{Locale: "en"}
+	if conflict, ok := findConflict(spec, existing); ok {
+		t.Errorf("got %v, want no conflict when the collation differs", conflict.Name)
+	}
+}
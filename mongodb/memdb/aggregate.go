@@ -0,0 +1,302 @@
+package memdb
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func aggregate(docs []bson.D, stages []bson.D) ([]bson.D, error) {
+	for _, stage := range stages {
+		if len(stage) != 1 {
+			return nil, unsupported("pipeline stage with more than one key")
+		}
+		var err error
+		if docs, err = runStage(docs, stage[0].Key, stage[0].Value); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func runStage(docs []bson.D, name string, arg interface{}) ([]bson.D, error) {
+	switch name {
+	case "$match":
+		var query, _ = arg.(bson.D)
+		var result []bson.D
+		for _, doc := range docs {
+			var ok, err = matches(doc, query)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result = append(result, doc)
+			}
+		}
+		return result, nil
+	case "$project":
+		var spec, _ = arg.(bson.D)
+		var result = make([]bson.D, 0, len(docs))
+		for _, doc := range docs {
+			var projected, err = project(doc, spec, true)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, projected)
+		}
+		return result, nil
+	case "$group":
+		var spec, ok = arg.(bson.D)
+		if !ok {
+			return nil, unsupported("$group argument")
+		}
+		return group(docs, spec)
+	case "$sort":
+		return sortDocs(docs, arg)
+	case "$skip":
+		var n = toInt64(arg)
+		return skipLimit(docs, &n, nil), nil
+	case "$limit":
+		var n = toInt64(arg)
+		return skipLimit(docs, nil, &n), nil
+	case "$count":
+		var field, _ = arg.(string)
+		return []bson.D{{{Key: field, Value: int32(len(docs))}}}, nil
+	case "$unwind":
+		return unwind(docs, arg)
+	}
+	return nil, unsupported("pipeline stage " + name)
+}
+
+// evalExpr evaluates the expressions supported by the in-memory aggregation,
+// field paths like "$campaign.id", embedded documents of expressions and literals
+func evalExpr(doc bson.D, expr interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case string:
+		if strings.HasPrefix(e, "$") {
+			var values = lookup(doc, strings.Split(e[1:], "."))
+			if len(values) == 0 {
+				return nil, nil
+			}
+			if len(values) > 1 {
+				return bson.A(values), nil
+			}
+			return values[0], nil
+		}
+		return e, nil
+	case bson.D:
+		if len(e) == 1 && e[0].Key == "$literal" {
+			return e[0].Value, nil
+		}
+		if isOperatorDoc(e) {
+			return nil, unsupported("expression operator " + e[0].Key)
+		}
+		var result = make(bson.D, 0, len(e))
+		for _, f := range e {
+			var value, err = evalExpr(doc, f.Value)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, bson.E{Key: f.Key, Value: value})
+		}
+		return result, nil
+	}
+	return expr, nil
+}
+
+type groupState struct {
+	id     interface{}
+	values map[string]interface{}
+	counts map[string]int // used by $avg
+	seen   map[string]bool
+}
+
+// accumulator is an output field of $group like {total: {$sum: "$clicks"}}
+type accumulator struct {
+	field string
+	op    string
+	arg   interface{}
+}
+
+func group(docs []bson.D, spec bson.D) ([]bson.D, error) {
+	var idExpr, ok = getKey(spec, "_id")
+	if !ok {
+		return nil, unsupported("$group without _id")
+	}
+	var accumulators []accumulator
+	for _, e := range spec {
+		if e.Key == "_id" {
+			continue
+		}
+		var accDoc, isDoc = e.Value.(bson.D)
+		if !isDoc || len(accDoc) != 1 {
+			return nil, unsupported("accumulator for " + e.Key)
+		}
+		accumulators = append(accumulators, accumulator{field: e.Key, op: accDoc[0].Key, arg: accDoc[0].Value})
+	}
+
+	var groups = make(map[string]*groupState)
+	var order []string
+	for _, doc := range docs {
+		var id, err = evalExpr(doc, idExpr)
+		if err != nil {
+			return nil, err
+		}
+		var key = groupKey(id)
+		var state, found = groups[key]
+		if !found {
+			state = &groupState{id: id, values: make(map[string]interface{}), counts: make(map[string]int), seen: make(map[string]bool)}
+			groups[key] = state
+			order = append(order, key)
+		}
+		for _, acc := range accumulators {
+			var value, err = evalExpr(doc, acc.arg)
+			if err != nil {
+				return nil, err
+			}
+			if err := accumulate(state, acc.field, acc.op, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var result = make([]bson.D, 0, len(order))
+	for _, key := range order {
+		var state = groups[key]
+		var doc = bson.D{{Key: "_id", Value: state.id}}
+		for _, acc := range accumulators {
+			doc = append(doc, bson.E{Key: acc.field, Value: finalize(state, acc.field, acc.op)})
+		}
+		result = append(result, doc)
+	}
+	return result, nil
+}
+
+func accumulate(state *groupState, field, op string, value interface{}) error {
+	var current, exists = state.values[field]
+	switch op {
+	case "$sum":
+		if !exists {
+			current = int32(0)
+		}
+		if isNumber(value) {
+			current = addNumbers(current, value)
+		}
+		state.values[field] = current
+	case "$avg":
+		if !exists {
+			current = float64(0)
+		}
+		if f, ok := toFloat(value); ok {
+			current = current.(float64) + f
+			state.counts[field]++
+		}
+		state.values[field] = current
+	case "$min", "$max":
+		if value == nil {
+			return nil
+		}
+		var cmp = sortCompare(value, current)
+		if !exists || current == nil || (op == "$min" && cmp < 0) || (op == "$max" && cmp > 0) {
+			state.values[field] = value
+		}
+	case "$first":
+		if !state.seen[field] {
+			state.values[field] = value
+		}
+	case "$last":
+		state.values[field] = value
+	case "$push":
+		var arr, _ = current.(bson.A)
+		state.values[field] = append(arr, value)
+	case "$addToSet":
+		var arr, _ = current.(bson.A)
+		for _, v := range arr {
+			if valuesEqual(v, value) {
+				return nil
+			}
+		}
+		state.values[field] = append(arr, value)
+	default:
+		return unsupported("accumulator " + op)
+	}
+	state.seen[field] = true
+	return nil
+}
+
+func finalize(state *groupState, field, op string) interface{} {
+	var value = state.values[field]
+	switch op {
+	case "$avg":
+		if state.counts[field] == 0 {
+			return nil
+		}
+		return value.(float64) / float64(state.counts[field])
+	case "$push", "$addToSet":
+		if value == nil {
+			return bson.A{}
+		}
+	}
+	return value
+}
+
+// groupKey returns a string which is same for equal group ids, numbers of
+// different types are grouped together like the server does while documents
+// with the same fields in another order are different groups
+func groupKey(v interface{}) string {
+	switch t := v.(type) {
+	case bson.D:
+		var parts []string
+		for _, e := range t {
+			parts = append(parts, e.Key+":"+groupKey(e.Value))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	case bson.A:
+		var parts []string
+		for _, e := range t {
+			parts = append(parts, groupKey(e))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	}
+	if f, ok := toFloat(v); ok {
+		return fmt.Sprintf("n:%v", f)
+	}
+	return fmt.Sprintf("%T:%v", v, v)
+}
+
+func unwind(docs []bson.D, arg interface{}) ([]bson.D, error) {
+	var path string
+	var preserve bool
+	switch a := arg.(type) {
+	case string:
+		path = a
+	case bson.D:
+		var p, _ = getKey(a, "path")
+		var keep, _ = getKey(a, "preserveNullAndEmptyArrays")
+		path, _ = p.(string)
+		preserve = truthy(keep)
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, unsupported("$unwind path")
+	}
+	path = path[1:]
+
+	var result []bson.D
+	for _, doc := range docs {
+		var value, found = getPath(doc, path)
+		var arr, isArr = value.(bson.A)
+		switch {
+		case isArr && len(arr) > 0:
+			for _, elem := range arr {
+				var copied = deepCopy(doc).(bson.D)
+				result = append(result, setPath(copied, path, deepCopy(elem)))
+			}
+		case found && value != nil && !isArr:
+			result = append(result, doc)
+		case preserve:
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func aggregateDocs(t *testing.T, coll *Collection, pipeline interface{}) []bson.M {
+	t.Helper()
+	var cursor, err = coll.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		t.Fatalf("aggregate %v: %v", pipeline, err)
+	}
+	var docs = []bson.M{}
+	for cursor.Next(context.Background()) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func newOrders(t *testing.T) *Collection {
+	return newTestCollection(t,
+		bson.M{"_id": int32(1), "site": "a", "amount": int32(10), "price": 1.5, "tags": bson.A{"x", "y"}, "user": bson.M{"country": "IN"}},
+		bson.M{"_id": int32(2), "site": "b", "amount": int32(20), "price": 2.5, "tags": bson.A{"y"}, "user": bson.M{"country": "US"}},
+		bson.M{"_id": int32(3), "site": "a", "amount": int64(30), "tags": bson.A{}, "user": bson.M{"country": "IN"}},
+		bson.M{"_id": int32(4), "site": "c", "amount": "n/a", "user": bson.M{"country": "US"}},
+	)
+}
+
+func TestAggregateStages(t *testing.T) {
+	var tests = []struct {
+		name     string
+		pipeline []bson.M
+		want     []bson.M
+	}{
+		{"$match", []bson.M{{"$match": bson.M{"site": "a"}}, {"$project": bson.M{"_id": 1}}},
+			[]bson.M{{"_id": int32(1)}, {"_id": int32(3)}}},
+		{"$project with field paths and literals", []bson.M{{"$match": bson.M{"_id": int32(1)}}, {"$project": bson.M{"_id": 0, "country": "$user.country", "kind": bson.M{"$literal": "order"}, "missing": "$nope"}}},
+			[]bson.M{{"country": "IN", "kind": "order", "missing": nil}}},
+		{"$sort $skip $limit", []bson.M{{"$sort": bson.M{"_id": -1}}, {"$skip": int32(1)}, {"$limit": int32(2)}, {"$project": bson.M{"_id": 1}}},
+			[]bson.M{{"_id": int32(3)}, {"_id": int32(2)}}},
+		{"$count", []bson.M{{"$match": bson.M{"site": "a"}}, {"$count": "total"}},
+			[]bson.M{{"total": int32(2)}}},
+		{"$unwind", []bson.M{{"$unwind": "$tags"}, {"$project": bson.M{"tags": 1}}},
+			[]bson.M{{"_id": int32(1), "tags": "x"}, {"_id": int32(1), "tags": "y"}, {"_id": int32(2), "tags": "y"}}},
+		{"$unwind preserving empty arrays", []bson.M{{"$unwind": bson.M{"path": "$tags", "preserveNullAndEmptyArrays": true}}, {"$project": bson.M{"tags": 1}}},
+			[]bson.M{{"_id": int32(1), "tags": "x"}, {"_id": int32(1), "tags": "y"}, {"_id": int32(2), "tags": "y"}, {"_id": int32(3), "tags": bson.A{}}, {"_id": int32(4)}}},
+		{"$group $sum promotes the types", []bson.M{{"$group": bson.M{"_id": "$site", "total": bson.M{"$sum": "$amount"}, "count": bson.M{"$sum": int32(1)}}}, {"$sort": bson.M{"_id": 1}}},
+			[]bson.M{{"_id": "a", "total": int64(40), "count": int32(2)}, {"_id": "b", "total": int32(20), "count": int32(1)}, {"_id": "c", "total": int32(0), "count": int32(1)}}},
+		{"$group $avg ignores non numbers", []bson.M{{"$group": bson.M{"_id": nil, "avg": bson.M{"$avg": "$price"}, "none": bson.M{"$avg": "$nope"}}}},
+			[]bson.M{{"_id": nil, "avg": 2.0, "none": nil}}},
+		{"$group $min $max", []bson.M{{"$match": bson.M{"site": bson.M{"$ne": "c"}}}, {"$group": bson.M{"_id": nil, "min": bson.M{"$min": "$amount"}, "max": bson.M{"$max": "$amount"}, "maxPrice": bson.M{"$max": "$price"}}}},
+			[]bson.M{{"_id": nil, "min": int32(10), "max": int64(30), "maxPrice": 2.5}}},
+		{"$group $first $last", []bson.M{{"$sort": bson.M{"_id": 1}}, {"$group": bson.M{"_id": "$user.country", "first": bson.M{"$first": "$_id"}, "last": bson.M{"$last": "$_id"}}}, {"$sort": bson.M{"_id": 1}}},
+			[]bson.M{{"_id": "IN", "first": int32(1), "last": int32(3)}, {"_id": "US", "first": int32(2), "last": int32(4)}}},
+		{"$group $push $addToSet", []bson.M{{"$group": bson.M{"_id": "$user.country", "sites": bson.M{"$push": "$site"}, "unique": bson.M{"$addToSet": "$site"}}}, {"$sort": bson.M{"_id": 1}}},
+			[]bson.M{{"_id": "IN", "sites": bson.A{"a", "a"}, "unique": bson.A{"a"}}, {"_id": "US", "sites": bson.A{"b", "c"}, "unique": bson.A{"b", "c"}}}},
+		{"$group by a document", []bson.M{{"$group": bson.M{"_id": bson.M{"site": "$site", "country": "$user.country"}, "n": bson.M{"$sum": int32(1)}}}, {"$match": bson.M{"_id.site": "a"}}},
+			[]bson.M{{"_id": bson.M{"site": "a", "country": "IN"}, "n": int32(2)}}},
+		{"$group numbers of different types together", []bson.M{{"$match": bson.M{"amount": bson.M{"$in": bson.A{int32(10), int64(30)}}}}, {"$project": bson.M{"k": bson.M{"$literal": int32(1)}, "amount": 1}}, {"$group": bson.M{"_id": "$k", "n": bson.M{"$sum": int32(1)}}}},
+			[]bson.M{{"_id": int32(1), "n": int32(2)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var coll = newOrders(t)
+			if got := aggregateDocs(t, coll, tt.pipeline); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateAll(t *testing.T) {
+	var coll = newOrders(t)
+	var cursor, err = coll.Aggregate(context.Background(), []bson.M{{"$match": bson.M{"_id": int32(2)}}, {"$project": bson.M{"site": 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// interface{} elements are decoded as bson.D like the driver does
+	var results []interface{}
+	if err := cursor.All(context.Background(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if _, ok := results[0].(bson.D); !ok {
+		t.Errorf("got %T, want bson.D", results[0])
+	}
+}
+
+func TestAggregateUnsupported(t *testing.T) {
+	var tests = []struct {
+		name     string
+		pipeline []bson.M
+	}{
+		{"stage", []bson.M{{"$lookup": bson.M{"from": "other"}}}},
+		{"accumulator", []bson.M{{"$group": bson.M{"_id": nil, "n": bson.M{"$stdDevPop": "$amount"}}}}},
+		{"expression", []bson.M{{"$project": bson.M{"n": bson.M{"$add": bson.A{"$amount", int32(1)}}}}}},
+		{"group without _id", []bson.M{{"$group": bson.M{"n": bson.M{"$sum": int32(1)}}}}},
+		{"stage with two keys", []bson.M{{"$match": bson.M{}, "$limit": int32(1)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var coll = newOrders(t)
+			if _, err := coll.Aggregate(context.Background(), tt.pipeline); !errors.Is(err, errUnsupported) {
+				t.Errorf("got %v, want an unsupported error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Cursor struct iterates over the documents returned by Find or Aggregate
+type Cursor struct {
+	docs    []bson.D
+	pos     int
+	current bson.D
+	err     error
+}
+
+func newCursor(docs []bson.D) *Cursor {
+	return &Cursor{docs: docs}
+}
+
+// Next method will move to the next document, false is returned at the end
+func (c *Cursor) Next(ctx context.Context) bool {
+	if c.err != nil || c.pos >= len(c.docs) {
+		c.current = nil
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		c.err = err
+		return false
+	}
+	c.current = c.docs[c.pos]
+	c.pos++
+	return true
+}
+
+// Decode method will decode the current document into val
+func (c *Cursor) Decode(val interface{}) error {
+	if c.current == nil {
+		return errors.New("memdb: cursor is not positioned on a document")
+	}
+	return decode(c.current, val)
+}
+
+// All method will decode the remaining documents into the slice pointed by
+// results, elements of type interface{} are decoded as bson.D like the driver
+func (c *Cursor) All(ctx context.Context, results interface{}) error {
+	var ptr = reflect.ValueOf(results)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Slice {
+		return errors.New("memdb: results argument must be a pointer to a slice")
+	}
+	var slice = ptr.Elem()
+	var elemType = slice.Type().Elem()
+	slice.Set(slice.Slice(0, 0))
+	for c.Next(ctx) {
+		var target reflect.Value
+		if elemType.Kind() == reflect.Interface {
+			var d bson.D
+			if err := decode(c.current, &d); err != nil {
+				return err
+			}
+			target = reflect.ValueOf(d)
+		} else {
+			var elem = reflect.New(elemType)
+			if err := decode(c.current, elem.Interface()); err != nil {
+				return err
+			}
+			target = elem.Elem()
+		}
+		slice.Set(reflect.Append(slice, target))
+	}
+	return c.Close(ctx)
+}
+
+// Err method will return the error which stopped the iteration
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close method will release the documents of the cursor
+func (c *Cursor) Close(ctx context.Context) error {
+	c.docs = nil
+	c.current = nil
+	return c.err
+}
@@ -0,0 +1,399 @@
+// Package memdb contains an in-memory implementation of mongodb.Database which
+// can be used in unit tests instead of a live MongoDB eg: models.NewStore(memdb.New("test"))
+package memdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/trustsignalio/golangutils/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const duplicateKeyCode = 11000
+
+var _ mongodb.Database = (*Database)(nil)
+var _ mongodb.Collection = (*Collection)(nil)
+var _ mongodb.Cursor = (*Cursor)(nil)
+
+// Database struct holds the collections in memory
+type Database struct {
+	name        string
+	mu          sync.Mutex
+	collections map[string]*Collection
+}
+
+// Collection struct holds the documents of a collection in insertion order
+type Collection struct {
+	name string
+	mu   sync.RWMutex
+	docs []bson.D
+}
+
+// New method will return an empty in-memory database
+func New(name string) *Database {
+	return &Database{name: name, collections: make(map[string]*Collection)}
+}
+
+// Name method will return the name of the database
+func (d *Database) Name() string {
+	return d.name
+}
+
+// Collection method will return the collection, it is created if it does not exist
+func (d *Database) Collection(name string) mongodb.Collection {
+	return d.collection(name)
+}
+
+// Drop method will remove all the collections and their documents
+func (d *Database) Drop() {
+	d.mu.Lock()
+	d.collections = make(map[string]*Collection)
+	d.mu.Unlock()
+}
+
+func (d *Database) collection(name string) *Collection {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var c, ok = d.collections[name]
+	if !ok {
+		c = &Collection{name: name}
+		d.collections[name] = c
+	}
+	return c
+}
+
+// Name method will return the name of the collection
+func (c *Collection) Name() string {
+	return c.name
+}
+
+// FindOne method will return the first document matching the filter after sorting and skipping
+func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) mongodb.SingleResult {
+	var o = options.MergeFindOneOptions(opts...)
+	var limit int64 = 1
+	var docs, err = c.find(filter, o.Sort, o.Skip, &limit, o.Projection)
+	if err != nil {
+		return &singleResult{err: err}
+	}
+	if len(docs) == 0 {
+		return &singleResult{err: mongo.ErrNoDocuments}
+	}
+	return &singleResult{doc: docs[0]}
+}
+
+// Find method will return a cursor over the matching documents
+func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (mongodb.Cursor, error) {
+	var o = options.MergeFindOptions(opts...)
+	var docs, err = c.find(filter, o.Sort, o.Skip, o.Limit, o.Projection)
+	if err != nil {
+		return nil, err
+	}
+	return newCursor(docs), nil
+}
+
+func (c *Collection) find(filter, sortSpec interface{}, skip, limit *int64, projection interface{}) ([]bson.D, error) {
+	var query, err = toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	var docs []bson.D
+	for _, doc := range c.docs {
+		ok, err := matches(doc, query)
+		if err != nil {
+			c.mu.RUnlock()
+			return nil, err
+		}
+		if ok {
+			docs = append(docs, deepCopy(doc).(bson.D))
+		}
+	}
+	c.mu.RUnlock()
+
+	if sortSpec != nil {
+		if docs, err = sortDocs(docs, sortSpec); err != nil {
+			return nil, err
+		}
+	}
+	docs = skipLimit(docs, skip, limit)
+	if projection != nil {
+		var spec, err = toDoc(projection)
+		if err != nil {
+			return nil, err
+		}
+		for i, doc := range docs {
+			if docs[i], err = project(doc, spec, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return docs, nil
+}
+
+// InsertOne method will insert the document, an ObjectID is generated when _id is missing
+func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	var doc, err = toDoc(document)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, err := c.insert(doc)
+	if err != nil {
+		return nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: duplicateKeyCode, Message: err.Error()}}}
+	}
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+// InsertMany method will insert the documents, with ordered inserts the first
+// duplicate stops the insert otherwise the remaining documents are inserted
+func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	var o = options.MergeInsertManyOptions(opts...)
+	var ordered = o.Ordered == nil || *o.Ordered
+	var result = &mongo.InsertManyResult{}
+	var writeErrors []mongo.BulkWriteError
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, document := range documents {
+		var doc, err = toDoc(document)
+		if err != nil {
+			return result, err
+		}
+		id, err := c.insert(doc)
+		if err != nil {
+			writeErrors = append(writeErrors, mongo.BulkWriteError{WriteError: mongo.WriteError{Index: i, Code: duplicateKeyCode, Message: err.Error()}})
+			if ordered {
+				break
+			}
+			continue
+		}
+		result.InsertedIDs = append(result.InsertedIDs, id)
+	}
+	if len(writeErrors) > 0 {
+		return result, mongo.BulkWriteException{WriteErrors: writeErrors}
+	}
+	return result, nil
+}
+
+// insert must be called with the write lock held, a generated _id is added
+// as the first field like the driver does
+func (c *Collection) insert(doc bson.D) (interface{}, error) {
+	var id, ok = getKey(doc, "_id")
+	if !ok {
+		id = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	}
+	for _, existing := range c.docs {
+		if existingID, _ := getKey(existing, "_id"); valuesEqual(existingID, id) {
+			return nil, fmt.Errorf("E11000 duplicate key error collection: %s index: _id_ dup key: { _id: %v }", c.name, id)
+		}
+	}
+	c.docs = append(c.docs, doc)
+	return id, nil
+}
+
+// UpdateOne method will update the first document matching the filter
+func (c *Collection) UpdateOne(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(filter, update, false, opts...)
+}
+
+// UpdateMany method will update all the documents matching the filter
+func (c *Collection) UpdateMany(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.update(filter, update, true, opts...)
+}
+
+func (c *Collection) update(filter, update interface{}, multi bool, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	var o = options.MergeUpdateOptions(opts...)
+	var query, err = toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	updateDoc, err := toDoc(update)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var result = &mongo.UpdateResult{}
+	for i, doc := range c.docs {
+		ok, err := matches(doc, query)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		result.MatchedCount++
+		updated, err := applyUpdate(deepCopy(doc).(bson.D), updateDoc, false)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(updated, doc) {
+			c.docs[i] = updated
+			result.ModifiedCount++
+		}
+		if !multi {
+			break
+		}
+	}
+
+	if result.MatchedCount == 0 && o.Upsert != nil && *o.Upsert {
+		var doc, err = applyUpdate(seedFromFilter(bson.D{}, query), updateDoc, true)
+		if err != nil {
+			return nil, err
+		}
+		id, err := c.insert(doc)
+		if err != nil {
+			return nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: duplicateKeyCode, Message: err.Error()}}}
+		}
+		result.UpsertedCount = 1
+		result.UpsertedID = id
+	}
+	return result, nil
+}
+
+// DeleteOne method will delete the first document matching the filter
+func (c *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(filter, false)
+}
+
+// DeleteMany method will delete all the documents matching the filter
+func (c *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.delete(filter, true)
+}
+
+func (c *Collection) delete(filter interface{}, multi bool) (*mongo.DeleteResult, error) {
+	var query, err = toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var result = &mongo.DeleteResult{}
+	var kept = c.docs[:0]
+	for _, doc := range c.docs {
+		if multi || result.DeletedCount == 0 {
+			ok, err := matches(doc, query)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result.DeletedCount++
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+	c.docs = kept
+	return result, nil
+}
+
+// CountDocuments method will count the documents matching the filter
+func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	var o = options.MergeCountOptions(opts...)
+	var docs, err = c.find(filter, nil, o.Skip, o.Limit, nil)
+	return int64(len(docs)), err
+}
+
+// Aggregate method will run the pipeline, the supported stages are $match,
+// $group, $project, $sort, $skip, $limit, $unwind and $count
+func (c *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (mongodb.Cursor, error) {
+	var stages, err = toPipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := c.find(nil, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	docs, err = aggregate(docs, stages)
+	if err != nil {
+		return nil, err
+	}
+	return newCursor(docs), nil
+}
+
+type singleResult struct {
+	doc bson.D
+	err error
+}
+
+func (r *singleResult) Err() error {
+	return r.err
+}
+
+func (r *singleResult) Decode(v interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return decode(r.doc, v)
+}
+
+// toDoc converts the filter, update or document to a bson.D by round tripping
+// through bson so that the values have the same types and the fields the same
+// order as returned by the server
+func toDoc(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	var data, err = bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc = bson.D{}
+	err = bson.Unmarshal(data, &doc)
+	return doc, err
+}
+
+func toPipeline(pipeline interface{}) ([]bson.D, error) {
+	var data, err = bson.Marshal(bson.M{"pipeline": pipeline})
+	if err != nil {
+		return nil, err
+	}
+	var wrapper struct {
+		Pipeline []bson.D `bson:"pipeline"`
+	}
+	err = bson.Unmarshal(data, &wrapper)
+	return wrapper.Pipeline, err
+}
+
+func decode(doc bson.D, v interface{}) error {
+	var data, err = bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, v)
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.D:
+		var d = make(bson.D, len(t))
+		for i, e := range t {
+			d[i] = bson.E{Key: e.Key, Value: deepCopy(e.Value)}
+		}
+		return d
+	case bson.A:
+		var a = make(bson.A, len(t))
+		for i, val := range t {
+			a[i] = deepCopy(val)
+		}
+		return a
+	}
+	return v
+}
+
+var errUnsupported = errors.New("memdb: unsupported")
+
+func unsupported(what string) error {
+	return fmt.Errorf("%w %s", errUnsupported, what)
+}
@@ -0,0 +1,635 @@
+package memdb
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matches evaluates the query filter on the document with the semantics of
+// the server: a condition on an array field matches if the array itself or
+// any of its elements matches
+func matches(doc bson.D, query bson.D) (bool, error) {
+	for _, q := range query {
+		var ok bool
+		var err error
+		switch q.Key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, q.Key, q.Value)
+		case "$comment":
+			ok = true
+		default:
+			if strings.HasPrefix(q.Key, "$") {
+				return false, unsupported("query operator " + q.Key)
+			}
+			ok, err = matchField(doc, q.Key, q.Value)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.D, op string, cond interface{}) (bool, error) {
+	var clauses, ok = cond.(bson.A)
+	if !ok || len(clauses) == 0 {
+		return false, unsupported(op + " without an array of clauses")
+	}
+	for _, c := range clauses {
+		var clause, isDoc = c.(bson.D)
+		if !isDoc {
+			return false, unsupported(op + " clause which is not a document")
+		}
+		var matched, err = matches(doc, clause)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+func matchField(doc bson.D, path string, cond interface{}) (bool, error) {
+	var raw = lookup(doc, strings.Split(path, "."))
+	if ops, ok := cond.(bson.D); ok && isOperatorDoc(ops) {
+		return matchOperators(raw, ops)
+	}
+	return matchEq(raw, cond), nil
+}
+
+func isOperatorDoc(d bson.D) bool {
+	return len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
+
+func matchOperators(raw []interface{}, ops bson.D) (bool, error) {
+	for _, o := range ops {
+		var op, arg = o.Key, o.Value
+		var ok bool
+		var err error
+		switch op {
+		case "$eq":
+			ok = matchEq(raw, arg)
+		case "$ne":
+			ok = !matchEq(raw, arg)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = matchCompare(raw, op, arg)
+		case "$in", "$nin":
+			var values, isArr = arg.(bson.A)
+			if !isArr {
+				return false, unsupported(op + " without an array")
+			}
+			ok = matchIn(raw, values)
+			if op == "$nin" {
+				ok = !ok
+			}
+		case "$exists":
+			ok = (len(raw) > 0) == truthy(arg)
+		case "$regex":
+			var options, _ = getKey(ops, "$options")
+			var re, err = compileRegex(arg, options)
+			if err != nil {
+				return false, err
+			}
+			ok = matchRegex(raw, re)
+		case "$options":
+			ok = true
+		case "$not":
+			if sub, isDoc := arg.(bson.D); isDoc {
+				ok, err = matchOperators(raw, sub)
+			} else if re, isRe := arg.(primitive.Regex); isRe {
+				ok = matchEq(raw, re)
+			} else {
+				return false, unsupported("$not argument")
+			}
+			ok = !ok
+		case "$size":
+			ok = matchSize(raw, arg)
+		case "$all":
+			var values, isArr = arg.(bson.A)
+			if !isArr {
+				return false, unsupported("$all without an array")
+			}
+			ok = len(values) > 0
+			for _, v := range values {
+				if !matchEq(raw, v) {
+					ok = false
+					break
+				}
+			}
+		case "$elemMatch":
+			var sub, isDoc = arg.(bson.D)
+			if !isDoc {
+				return false, unsupported("$elemMatch argument")
+			}
+			ok, err = matchElem(raw, sub)
+		default:
+			return false, unsupported("query operator " + op)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// lookup returns the values at the dotted path, arrays of documents are
+// traversed so "items.sku" returns the sku of every item
+func lookup(v interface{}, parts []string) []interface{} {
+	if len(parts) == 0 {
+		return []interface{}{v}
+	}
+	switch t := v.(type) {
+	case bson.D:
+		var child, ok = getKey(t, parts[0])
+		if !ok {
+			return nil
+		}
+		return lookup(child, parts[1:])
+	case bson.A:
+		if idx, err := strconv.Atoi(parts[0]); err == nil {
+			if idx >= 0 && idx < len(t) {
+				return lookup(t[idx], parts[1:])
+			}
+			return nil
+		}
+		var result []interface{}
+		for _, elem := range t {
+			if _, ok := elem.(bson.D); ok {
+				result = append(result, lookup(elem, parts)...)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// expand adds the elements of the arrays to the candidate values
+func expand(raw []interface{}) []interface{} {
+	var result []interface{}
+	for _, v := range raw {
+		result = append(result, v)
+		if arr, ok := v.(bson.A); ok {
+			result = append(result, arr...)
+		}
+	}
+	return result
+}
+
+func matchEq(raw []interface{}, arg interface{}) bool {
+	if arg == nil && len(raw) == 0 {
+		return true
+	}
+	if re, ok := arg.(primitive.Regex); ok {
+		var compiled, err = compileRegex(re, nil)
+		return err == nil && matchRegex(raw, compiled)
+	}
+	for _, v := range expand(raw) {
+		if valuesEqual(v, arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIn(raw []interface{}, values bson.A) bool {
+	for _, v := range values {
+		if matchEq(raw, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCompare(raw []interface{}, op string, arg interface{}) bool {
+	for _, v := range expand(raw) {
+		var cmp, ok = compareValues(v, arg)
+		if !ok {
+			continue
+		}
+		switch {
+		case op == "$gt" && cmp > 0, op == "$gte" && cmp >= 0, op == "$lt" && cmp < 0, op == "$lte" && cmp <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+func matchSize(raw []interface{}, arg interface{}) bool {
+	var size, ok = toFloat(arg)
+	if !ok {
+		return false
+	}
+	for _, v := range raw {
+		if arr, isArr := v.(bson.A); isArr && float64(len(arr)) == size {
+			return true
+		}
+	}
+	return false
+}
+
+func matchElem(raw []interface{}, sub bson.D) (bool, error) {
+	for _, v := range raw {
+		var arr, isArr = v.(bson.A)
+		if !isArr {
+			continue
+		}
+		for _, elem := range arr {
+			var ok bool
+			var err error
+			if isOperatorDoc(sub) {
+				ok, err = matchOperators([]interface{}{elem}, sub)
+			} else if doc, isDoc := elem.(bson.D); isDoc {
+				ok, err = matches(doc, sub)
+			}
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func compileRegex(pattern, opts interface{}) (*regexp.Regexp, error) {
+	var expr, flags string
+	switch p := pattern.(type) {
+	case primitive.Regex:
+		expr, flags = p.Pattern, p.Options
+	case string:
+		expr = p
+	default:
+		return nil, unsupported("$regex argument")
+	}
+	if o, ok := opts.(string); ok {
+		flags += o
+	}
+	var prefix string
+	for _, f := range flags {
+		switch f {
+		case 'i', 'm', 's':
+			prefix += string(f)
+		}
+	}
+	if prefix != "" {
+		expr = "(?" + prefix + ")" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+func matchRegex(raw []interface{}, re *regexp.Regexp) bool {
+	for _, v := range expand(raw) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+// typeOrder is the order in which the server sorts the values of different types
+func typeOrder(v interface{}) int {
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int32, int64, float64, int, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	}
+	return 12
+}
+
+// compareValues compares two values of the same type class, ok is false when
+// the values can not be compared like a string with a number
+func compareValues(a, b interface{}) (int, bool) {
+	if typeOrder(a) != typeOrder(b) {
+		return 0, false
+	}
+	switch x := a.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 0, true
+	case string:
+		return strings.Compare(x, b.(string)), true
+	case primitive.ObjectID:
+		var y = b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:]), true
+	case bool:
+		var y = b.(bool)
+		if x == y {
+			return 0, true
+		} else if !x {
+			return -1, true
+		}
+		return 1, true
+	case primitive.DateTime:
+		return compareInt64(int64(x), int64(b.(primitive.DateTime))), true
+	case primitive.Timestamp:
+		var y = b.(primitive.Timestamp)
+		if x.T != y.T {
+			return compareInt64(int64(x.T), int64(y.T)), true
+		}
+		return compareInt64(int64(x.I), int64(y.I)), true
+	}
+	var fa, okA = toFloat(a)
+	var fb, okB = toFloat(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sortCompare orders values of different types the way the server does
+func sortCompare(a, b interface{}) int {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp
+	}
+	return compareInt64(int64(typeOrder(a)), int64(typeOrder(b)))
+}
+
+// valuesEqual compares the embedded documents field by field in order since
+// the server does not match {a: 1, b: 2} with {b: 2, a: 1}
+func valuesEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case bson.D:
+		var y, ok = b.(bson.D)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if x[i].Key != y[i].Key || !valuesEqual(x[i].Value, y[i].Value) {
+				return false
+			}
+		}
+		return true
+	case bson.A:
+		var y, ok = b.(bson.A)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !valuesEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	var cmp, ok = compareValues(a, b)
+	return ok && cmp == 0
+}
+
+func toSortSpec(spec interface{}) (bson.D, error) {
+	if d, ok := spec.(bson.D); ok {
+		return d, nil
+	}
+	var data, err = bson.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	err = bson.Unmarshal(data, &d)
+	return d, err
+}
+
+func sortDocs(docs []bson.D, spec interface{}) ([]bson.D, error) {
+	var keys, err = toSortSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, k := range keys {
+			var direction, _ = toFloat(k.Value)
+			var cmp = sortCompare(sortValue(docs[i], k.Key, direction), sortValue(docs[j], k.Key, direction))
+			if cmp != 0 {
+				return (cmp < 0) == (direction >= 0)
+			}
+		}
+		return false
+	})
+	return docs, nil
+}
+
+// sortValue returns the value used for sorting, for arrays the smallest
+// element is used in ascending sort and the largest in descending sort
+func sortValue(doc bson.D, path string, direction float64) interface{} {
+	var values = lookup(doc, strings.Split(path, "."))
+	var candidates []interface{}
+	for _, v := range values {
+		if arr, ok := v.(bson.A); ok && len(arr) > 0 {
+			candidates = append(candidates, arr...)
+		} else {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	var best = candidates[0]
+	for _, c := range candidates[1:] {
+		var cmp = sortCompare(c, best)
+		if (direction >= 0 && cmp < 0) || (direction < 0 && cmp > 0) {
+			best = c
+		}
+	}
+	return best
+}
+
+func skipLimit(docs []bson.D, skip, limit *int64) []bson.D {
+	if skip != nil && *skip > 0 {
+		if *skip >= int64(len(docs)) {
+			return nil
+		}
+		docs = docs[*skip:]
+	}
+	if limit != nil && *limit != 0 {
+		var n = *limit
+		if n < 0 {
+			n = -n
+		}
+		if n < int64(len(docs)) {
+			docs = docs[:n]
+		}
+	}
+	return docs
+}
+
+// project applies the inclusion or exclusion projection, with allowExpr the
+// aggregation form is accepted where a field can be set from "$path" or a
+// literal. The included fields keep the order of the document and the
+// computed fields are added after them
+func project(doc bson.D, spec bson.D, allowExpr bool) (bson.D, error) {
+	if len(spec) == 0 {
+		return doc, nil
+	}
+	var include = false
+	var idSpec, hasIDSpec = getKey(spec, "_id")
+	if len(spec) == 1 && hasIDSpec {
+		include = truthy(idSpec)
+	}
+	for _, e := range spec {
+		if e.Key == "_id" {
+			continue
+		}
+		include = !isFlag(e.Value) || truthy(e.Value)
+		break
+	}
+
+	var included []string
+	if include && (!hasIDSpec || !isFlag(idSpec) || truthy(idSpec)) {
+		included = append(included, "_id")
+	}
+	var excluded []string
+	var computed bson.D
+	for _, e := range spec {
+		switch {
+		case isFlag(e.Value) && truthy(e.Value):
+			included = append(included, e.Key)
+		case isFlag(e.Value):
+			excluded = append(excluded, e.Key)
+		case allowExpr:
+			computed = append(computed, e)
+		default:
+			return nil, unsupported("projection value for " + e.Key)
+		}
+	}
+
+	var result bson.D
+	if include {
+		result = includePaths(doc, included)
+	} else {
+		result = deepCopy(doc).(bson.D)
+	}
+	for _, path := range excluded {
+		result = unsetPath(result, path)
+	}
+	for _, e := range computed {
+		var value, err = evalExpr(doc, e.Value)
+		if err != nil {
+			return nil, err
+		}
+		result = setPath(result, e.Key, value)
+	}
+	return result, nil
+}
+
+// includePaths copies the fields of the document which are in the dotted
+// paths, the embedded documents and arrays of documents are projected as well
+func includePaths(doc bson.D, paths []string) bson.D {
+	var result = bson.D{}
+	for _, e := range doc {
+		var whole bool
+		var sub []string
+		for _, p := range paths {
+			if p == e.Key {
+				whole = true
+			} else if strings.HasPrefix(p, e.Key+".") {
+				sub = append(sub, p[len(e.Key)+1:])
+			}
+		}
+		switch value := e.Value.(type) {
+		case bson.D:
+			if whole {
+				result = append(result, bson.E{Key: e.Key, Value: deepCopy(value)})
+			} else if len(sub) > 0 {
+				result = append(result, bson.E{Key: e.Key, Value: includePaths(value, sub)})
+			}
+		case bson.A:
+			if whole {
+				result = append(result, bson.E{Key: e.Key, Value: deepCopy(value)})
+			} else if len(sub) > 0 {
+				var arr = bson.A{}
+				for _, item := range value {
+					if d, ok := item.(bson.D); ok {
+						arr = append(arr, includePaths(d, sub))
+					}
+				}
+				result = append(result, bson.E{Key: e.Key, Value: arr})
+			}
+		default:
+			if whole {
+				result = append(result, e)
+			}
+		}
+	}
+	return result
+}
+
+// isFlag reports the projection values which include or exclude a field
+func isFlag(v interface{}) bool {
+	var _, isBool = v.(bool)
+	return isBool || isNumber(v)
+}
+
+func isNumber(v interface{}) bool {
+	var _, ok = toFloat(v)
+	return ok
+}
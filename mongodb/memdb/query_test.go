@@ -0,0 +1,236 @@
+package memdb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newTestCollection returns a collection seeded with the documents
+func newTestCollection(t *testing.T, docs ...bson.M) *Collection {
+	t.Helper()
+	var coll = New("test").collection("items")
+	for _, doc := range docs {
+		if _, err := coll.InsertOne(context.Background(), doc); err != nil {
+			t.Fatalf("insert %v: %v", doc, err)
+		}
+	}
+	return coll
+}
+
+// findIDs returns the _id of the documents matching the filter in result order
+func findIDs(t *testing.T, coll *Collection, filter interface{}, opts ...*options.FindOptions) []interface{} {
+	t.Helper()
+	var cursor, err = coll.Find(context.Background(), filter, opts...)
+	if err != nil {
+		t.Fatalf("find %v: %v", filter, err)
+	}
+	var docs []bson.M
+	if err := cursor.All(context.Background(), &docs); err != nil {
+		t.Fatalf("decode %v: %v", filter, err)
+	}
+	var ids = []interface{}{}
+	for _, doc := range docs {
+		ids = append(ids, doc["_id"])
+	}
+	return ids
+}
+
+func ids(values ...interface{}) []interface{} {
+	if values == nil {
+		return []interface{}{}
+	}
+	return values
+}
+
+func TestFindOperators(t *testing.T) {
+	var coll = newTestCollection(t,
+		bson.M{"_id": int32(1), "name": "alpha", "qty": int32(5), "tags": bson.A{"red", "blue"}, "size": bson.D{{Key: "h", Value: int32(10)}, {Key: "uom", Value: "cm"}}},
+		bson.M{"_id": int32(2), "name": "beta", "qty": int64(15), "tags": bson.A{"blue"}, "size": bson.D{{Key: "h", Value: int32(20)}, {Key: "uom", Value: "in"}}},
+		bson.M{"_id": int32(3), "name": "gamma", "qty": 25.5, "tags": bson.A{}, "note": nil},
+		bson.M{"_id": int32(4), "name": "Delta", "tags": bson.A{bson.A{"red", "blue"}, "green"}},
+		bson.M{"_id": int32(5), "name": "epsilon", "qty": "n/a", "items": bson.A{
+			bson.M{"sku": "a", "qty": int32(1)},
+			bson.M{"sku": "b", "qty": int32(8)},
+		}},
+	)
+
+	var tests = []struct {
+		name   string
+		filter bson.M
+		want   []interface{}
+	}{
+		{"empty filter", bson.M{}, ids(int32(1), int32(2), int32(3), int32(4), int32(5))},
+		{"implicit eq", bson.M{"name": "beta"}, ids(int32(2))},
+		{"eq across number types", bson.M{"qty": 15.0}, ids(int32(2))},
+		{"eq on array element", bson.M{"tags": "blue"}, ids(int32(1), int32(2))},
+		{"array equality", bson.M{"tags": bson.A{"red", "blue"}}, ids(int32(1), int32(4))},
+		{"array equality is ordered", bson.M{"tags": bson.A{"blue", "red"}}, ids()},
+		{"empty array equality", bson.M{"tags": bson.A{}}, ids(int32(3))},
+		{"embedded document equality", bson.M{"size": bson.D{{Key: "h", Value: int32(10)}, {Key: "uom", Value: "cm"}}}, ids(int32(1))},
+		{"embedded document equality is ordered", bson.M{"size": bson.D{{Key: "uom", Value: "cm"}, {Key: "h", Value: int32(10)}}}, ids()},
+		{"dotted path", bson.M{"size.uom": "in"}, ids(int32(2))},
+		{"dotted path through array", bson.M{"items.sku": "b"}, ids(int32(5))},
+		{"array index path", bson.M{"tags.0": "red"}, ids(int32(1), int32(4))},
+		{"null matches missing and null", bson.M{"note": nil}, ids(int32(1), int32(2), int32(3), int32(4), int32(5))},
+		{"null on field present in some", bson.M{"qty": nil}, ids(int32(4))},
+		{"$eq null", bson.M{"qty": bson.M{"$eq": nil}}, ids(int32(4))},
+		{"$ne null", bson.M{"qty": bson.M{"$ne": nil}}, ids(int32(1), int32(2), int32(3), int32(5))},
+		{"$exists true on null value", bson.M{"note": bson.M{"$exists": true}}, ids(int32(3))},
+		{"$exists false", bson.M{"qty": bson.M{"$exists": false}}, ids(int32(4))},
+		{"$ne on array", bson.M{"tags": bson.M{"$ne": "blue"}}, ids(int32(3), int32(4), int32(5))},
+		{"$gt across number types", bson.M{"qty": bson.M{"$gt": int32(10)}}, ids(int32(2), int32(3))},
+		{"$gte and $lt", bson.M{"qty": bson.M{"$gte": int32(5), "$lt": int64(25)}}, ids(int32(1), int32(2))},
+		{"$lte does not compare strings with numbers", bson.M{"qty": bson.M{"$lte": int32(100)}}, ids(int32(1), int32(2), int32(3))},
+		{"$gt on strings", bson.M{"name": bson.M{"$gt": "delta"}}, ids(int32(3), int32(5))},
+		{"$in", bson.M{"name": bson.M{"$in": bson.A{"alpha", "gamma", "zeta"}}}, ids(int32(1), int32(3))},
+		{"$in on array field", bson.M{"tags": bson.M{"$in": bson.A{"green", "red"}}}, ids(int32(1), int32(4))},
+		{"$in with null", bson.M{"qty": bson.M{"$in": bson.A{nil, int32(5)}}}, ids(int32(1), int32(4))},
+		{"$in with regex", bson.M{"name": bson.M{"$in": bson.A{primitive.Regex{Pattern: "^de", Options: "i"}}}}, ids(int32(4))},
+		{"$nin", bson.M{"tags": bson.M{"$nin": bson.A{"blue", "green"}}}, ids(int32(3), int32(5))},
+		{"$all", bson.M{"tags": bson.M{"$all": bson.A{"red", "blue"}}}, ids(int32(1))},
+		{"$size", bson.M{"tags": bson.M{"$size": int32(1)}}, ids(int32(2))},
+		{"$regex with options", bson.M{"name": bson.M{"$regex": "^d", "$options": "i"}}, ids(int32(4))},
+		{"regex literal", bson.M{"name": primitive.Regex{Pattern: "a$"}}, ids(int32(1), int32(2), int32(3), int32(4))},
+		{"$not", bson.M{"qty": bson.M{"$not": bson.M{"$gt": int32(10)}}}, ids(int32(1), int32(4), int32(5))},
+		{"$elemMatch on documents", bson.M{"items": bson.M{"$elemMatch": bson.M{"sku": "b", "qty": bson.M{"$gt": int32(5)}}}}, ids(int32(5))},
+		{"$elemMatch needs one element for all conditions", bson.M{"items": bson.M{"$elemMatch": bson.M{"sku": "a", "qty": bson.M{"$gt": int32(5)}}}}, ids()},
+		{"dotted conditions may match different elements", bson.M{"items.sku": "a", "items.qty": bson.M{"$gt": int32(5)}}, ids(int32(5))},
+		{"$elemMatch on scalars", bson.M{"tags": bson.M{"$elemMatch": bson.M{"$gte": "c", "$lt": "h"}}}, ids(int32(4))},
+		{"$and", bson.M{"$and": bson.A{bson.M{"tags": "blue"}, bson.M{"qty": bson.M{"$gt": int32(10)}}}}, ids(int32(2))},
+		{"$or", bson.M{"$or": bson.A{bson.M{"name": "alpha"}, bson.M{"qty": "n/a"}}}, ids(int32(1), int32(5))},
+		{"$nor", bson.M{"$nor": bson.A{bson.M{"tags": "blue"}, bson.M{"qty": bson.M{"$exists": false}}}}, ids(int32(3), int32(5))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findIDs(t, coll, tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindUnsupportedOperator(t *testing.T) {
+	var coll = newTestCollection(t, bson.M{"_id": int32(1)})
+	if _, err := coll.Find(context.Background(), bson.M{"$where": "true"}); err == nil {
+		t.Error("expected an error for $where")
+	}
+	if _, err := coll.Find(context.Background(), bson.M{"a": bson.M{"$mod": bson.A{2, 0}}}); err == nil {
+		t.Error("expected an error for $mod")
+	}
+}
+
+func TestFindSortTypeOrder(t *testing.T) {
+	var coll = newTestCollection(t,
+		bson.M{"_id": "string", "v": "abc"},
+		bson.M{"_id": "int", "v": int32(5)},
+		bson.M{"_id": "missing"},
+		bson.M{"_id": "double", "v": 2.5},
+		bson.M{"_id": "null", "v": nil},
+		bson.M{"_id": "object", "v": bson.M{"a": int32(1)}},
+		bson.M{"_id": "bool", "v": true},
+		bson.M{"_id": "long", "v": int64(10)},
+		bson.M{"_id": "oid", "v": primitive.NilObjectID},
+		bson.M{"_id": "date", "v": primitive.DateTime(0)},
+	)
+	var tests = []struct {
+		name string
+		sort bson.D
+		want []interface{}
+	}{
+		// the stable sort keeps the insertion order of missing and null
+		{"ascending", bson.D{{Key: "v", Value: 1}}, ids("missing", "null", "double", "int", "long", "string", "object", "oid", "bool", "date")},
+		{"descending", bson.D{{Key: "v", Value: -1}}, ids("date", "bool", "oid", "object", "string", "long", "int", "double", "missing", "null")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got = findIDs(t, coll, bson.M{}, options.Find().SetSort(tt.sort))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindSortArrays(t *testing.T) {
+	var coll = newTestCollection(t,
+		bson.M{"_id": int32(1), "v": bson.A{int32(3), int32(9)}},
+		bson.M{"_id": int32(2), "v": int32(5)},
+		bson.M{"_id": int32(3), "v": bson.A{int32(1), int32(4)}},
+	)
+	// ascending uses the smallest element and descending the largest
+	if got, want := findIDs(t, coll, bson.M{}, options.Find().SetSort(bson.D{{Key: "v", Value: 1}})), ids(int32(3), int32(1), int32(2)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ascending got %v, want %v", got, want)
+	}
+	if got, want := findIDs(t, coll, bson.M{}, options.Find().SetSort(bson.D{{Key: "v", Value: -1}})), ids(int32(1), int32(2), int32(3)); !reflect.DeepEqual(got, want) {
+		t.Errorf("descending got %v, want %v", got, want)
+	}
+}
+
+func TestFindOptions(t *testing.T) {
+	var coll = newTestCollection(t,
+		bson.M{"_id": int32(1), "g": "a", "n": int32(3), "x": "one"},
+		bson.M{"_id": int32(2), "g": "b", "n": int32(1), "x": "two"},
+		bson.M{"_id": int32(3), "g": "a", "n": int32(2), "x": "three"},
+		bson.M{"_id": int32(4), "g": "b", "n": int32(4), "x": "four"},
+	)
+	var tests = []struct {
+		name string
+		opts *options.FindOptions
+		want []interface{}
+	}{
+		{"multi key sort", options.Find().SetSort(bson.D{{Key: "g", Value: -1}, {Key: "n", Value: 1}}), ids(int32(2), int32(4), int32(3), int32(1))},
+		{"skip and limit", options.Find().SetSort(bson.D{{Key: "n", Value: 1}}).SetSkip(1).SetLimit(2), ids(int32(3), int32(1))},
+		{"negative limit", options.Find().SetSort(bson.D{{Key: "n", Value: 1}}).SetLimit(-1), ids(int32(2))},
+		{"skip past the end", options.Find().SetSkip(10), ids()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findIDs(t, coll, bson.M{}, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindProjection(t *testing.T) {
+	var coll = newTestCollection(t, bson.M{"_id": int32(1), "a": int32(1), "b": bson.M{"c": int32(2), "d": int32(3)}, "e": "x"})
+	var tests = []struct {
+		name       string
+		projection bson.M
+		want       bson.M
+	}{
+		{"inclusion keeps _id", bson.M{"a": 1}, bson.M{"_id": int32(1), "a": int32(1)}},
+		{"inclusion without _id", bson.M{"a": 1, "_id": 0}, bson.M{"a": int32(1)}},
+		{"dotted inclusion", bson.M{"b.c": 1}, bson.M{"_id": int32(1), "b": bson.M{"c": int32(2)}}},
+		{"exclusion", bson.M{"b": 0, "e": false}, bson.M{"_id": int32(1), "a": int32(1)}},
+		{"dotted exclusion", bson.M{"b.d": 0}, bson.M{"_id": int32(1), "a": int32(1), "b": bson.M{"c": int32(2)}, "e": "x"}},
+		{"only _id", bson.M{"_id": 1}, bson.M{"_id": int32(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bson.M
+			if err := coll.FindOne(context.Background(), bson.M{}, options.FindOne().SetProjection(tt.projection)).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindReturnsCopies(t *testing.T) {
+	var coll = newTestCollection(t, bson.M{"_id": int32(1), "tags": bson.A{"a"}})
+	var cursor, _ = coll.Find(context.Background(), bson.M{})
+	cursor.Next(context.Background())
+	var tags, _ = getKey(cursor.(*Cursor).current, "tags")
+	tags.(bson.A)[0] = "changed"
+	if got := findIDs(t, coll, bson.M{"tags": "a"}); len(got) != 1 {
+		t.Errorf("stored document was modified through the cursor")
+	}
+}
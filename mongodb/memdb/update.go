@@ -0,0 +1,231 @@
+package memdb
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// applyUpdate applies the update operators on the document, an update without
+// operators replaces the whole document except the _id
+func applyUpdate(doc bson.D, update bson.D, isInsert bool) (bson.D, error) {
+	if !isOperatorDoc(update) {
+		var replaced = bson.D{}
+		var id, hasID = getKey(doc, "_id")
+		if hasID {
+			replaced = append(replaced, bson.E{Key: "_id", Value: id})
+		}
+		for _, e := range update {
+			if e.Key == "_id" && hasID {
+				continue
+			}
+			replaced = append(replaced, bson.E{Key: e.Key, Value: deepCopy(e.Value)})
+		}
+		return replaced, nil
+	}
+
+	for _, u := range update {
+		var fields, ok = u.Value.(bson.D)
+		if !ok {
+			return nil, unsupported(u.Key + " argument which is not a document")
+		}
+		for _, f := range fields {
+			if f.Key == "_id" && u.Key != "$setOnInsert" && !isInsert {
+				if current, found := getKey(doc, "_id"); found && !valuesEqual(current, f.Value) {
+					return nil, unsupported("update of the _id field")
+				}
+			}
+			var err error
+			if doc, err = applyOperator(doc, u.Key, f.Key, f.Value, isInsert); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return doc, nil
+}
+
+func applyOperator(doc bson.D, op, path string, value interface{}, isInsert bool) (bson.D, error) {
+	switch op {
+	case "$set":
+		return setPath(doc, path, deepCopy(value)), nil
+	case "$setOnInsert":
+		if isInsert {
+			return setPath(doc, path, deepCopy(value)), nil
+		}
+	case "$unset":
+		return unsetPath(doc, path), nil
+	case "$inc":
+		if !isNumber(value) {
+			return nil, unsupported("$inc with a value which is not a number")
+		}
+		var current, found = getPath(doc, path)
+		if !found || current == nil {
+			return setPath(doc, path, value), nil
+		}
+		if !isNumber(current) {
+			return nil, unsupported("$inc on a field which is not a number: " + path)
+		}
+		return setPath(doc, path, addNumbers(current, value)), nil
+	case "$min", "$max":
+		var current, found = getPath(doc, path)
+		var cmp = sortCompare(value, current)
+		if !found || (op == "$min" && cmp < 0) || (op == "$max" && cmp > 0) {
+			return setPath(doc, path, deepCopy(value)), nil
+		}
+	case "$push":
+		var current, found = getPath(doc, path)
+		var arr, isArr = current.(bson.A)
+		if found && !isArr {
+			return nil, unsupported("$push on a field which is not an array: " + path)
+		}
+		var each, _ = value.(bson.D)
+		if values, ok := getKey(each, "$each"); ok {
+			var items, _ = values.(bson.A)
+			arr = append(arr, deepCopy(items).(bson.A)...)
+		} else {
+			arr = append(arr, deepCopy(value))
+		}
+		return setPath(doc, path, arr), nil
+	default:
+		return nil, unsupported("update operator " + op)
+	}
+	return doc, nil
+}
+
+// addNumbers adds with the type promotion of the server, int32 overflows to
+// int64 and any double makes the result a double
+func addNumbers(a, b interface{}) interface{} {
+	var _, aFloat = a.(float64)
+	var _, bFloat = b.(float64)
+	if aFloat || bFloat {
+		var x, _ = toFloat(a)
+		var y, _ = toFloat(b)
+		return x + y
+	}
+	var x = toInt64(a)
+	var y = toInt64(b)
+	var sum = x + y
+	var _, aLong = a.(int64)
+	var _, bLong = b.(int64)
+	if aLong || bLong || sum > 1<<31-1 || sum < -1<<31 {
+		return sum
+	}
+	return int32(sum)
+}
+
+func toInt64(v interface{}) int64 {
+	switch t := v.(type) {
+	case int32:
+		return int64(t)
+	case int64:
+		return t
+	case int:
+		return int64(t)
+	}
+	return 0
+}
+
+// getKey returns the value of the top level key of the document
+func getKey(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// setKey replaces the value of the key in place, a new key is appended at
+// the end of the document like the server does
+func setKey(doc bson.D, key string, value interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+func deleteKey(doc bson.D, key string) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			return append(doc[:i:i], doc[i+1:]...)
+		}
+	}
+	return doc
+}
+
+func getPath(doc bson.D, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, p := range strings.Split(path, ".") {
+		var d, ok = current.(bson.D)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = getKey(d, p); !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath sets the value at the dotted path creating the embedded documents
+func setPath(doc bson.D, path string, value interface{}) bson.D {
+	return setParts(doc, strings.Split(path, "."), value)
+}
+
+func setParts(doc bson.D, parts []string, value interface{}) bson.D {
+	if len(parts) == 1 {
+		return setKey(doc, parts[0], value)
+	}
+	var child, _ = getKey(doc, parts[0])
+	var sub, ok = child.(bson.D)
+	if !ok {
+		sub = bson.D{}
+	}
+	return setKey(doc, parts[0], setParts(sub, parts[1:], value))
+}
+
+func unsetPath(doc bson.D, path string) bson.D {
+	return unsetParts(doc, strings.Split(path, "."))
+}
+
+func unsetParts(doc bson.D, parts []string) bson.D {
+	if len(parts) == 1 {
+		return deleteKey(doc, parts[0])
+	}
+	var child, _ = getKey(doc, parts[0])
+	var sub, ok = child.(bson.D)
+	if !ok {
+		return doc
+	}
+	return setKey(doc, parts[0], unsetParts(sub, parts[1:]))
+}
+
+// seedFromFilter copies the equality conditions of the filter into the
+// document which is inserted by an upsert
+func seedFromFilter(doc bson.D, query bson.D) bson.D {
+	for _, q := range query {
+		if q.Key == "$and" {
+			var clauses, _ = q.Value.(bson.A)
+			for _, c := range clauses {
+				if clause, ok := c.(bson.D); ok {
+					doc = seedFromFilter(doc, clause)
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(q.Key, "$") {
+			continue
+		}
+		if ops, ok := q.Value.(bson.D); ok && isOperatorDoc(ops) {
+			if eq, found := getKey(ops, "$eq"); found {
+				doc = setPath(doc, q.Key, deepCopy(eq))
+			}
+			continue
+		}
+		doc = setPath(doc, q.Key, deepCopy(q.Value))
+	}
+	return doc
+}
@@ -0,0 +1,312 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func findDoc(t *testing.T, coll *Collection, filter bson.M) bson.M {
+	t.Helper()
+	var doc bson.M
+	if err := coll.FindOne(context.Background(), filter).Decode(&doc); err != nil {
+		t.Fatalf("find %v: %v", filter, err)
+	}
+	return doc
+}
+
+func TestUpdateOperators(t *testing.T) {
+	var tests = []struct {
+		name   string
+		doc    bson.M
+		update bson.M
+		want   bson.M
+	}{
+		{"$set", bson.M{"a": int32(1)}, bson.M{"$set": bson.M{"b": "x"}}, bson.M{"a": int32(1), "b": "x"}},
+		{"$set dotted creates documents", bson.M{}, bson.M{"$set": bson.M{"a.b.c": int32(1)}}, bson.M{"a": bson.M{"b": bson.M{"c": int32(1)}}}},
+		{"$set dotted keeps siblings", bson.M{"a": bson.M{"x": int32(1)}}, bson.M{"$set": bson.M{"a.y": int32(2)}}, bson.M{"a": bson.M{"x": int32(1), "y": int32(2)}}},
+		{"$unset", bson.M{"a": int32(1), "b": int32(2)}, bson.M{"$unset": bson.M{"a": ""}}, bson.M{"b": int32(2)}},
+		{"$unset missing field", bson.M{"b": int32(2)}, bson.M{"$unset": bson.M{"a.c": ""}}, bson.M{"b": int32(2)}},
+		{"$inc int32", bson.M{"n": int32(1)}, bson.M{"$inc": bson.M{"n": int32(2)}}, bson.M{"n": int32(3)}},
+		{"$inc int32 overflows to int64", bson.M{"n": int32(1<<31 - 1)}, bson.M{"$inc": bson.M{"n": int32(1)}}, bson.M{"n": int64(1 << 31)}},
+		{"$inc int32 negative overflow", bson.M{"n": int32(-1 << 31)}, bson.M{"$inc": bson.M{"n": int32(-1)}}, bson.M{"n": int64(-1<<31 - 1)}},
+		{"$inc int32 by int64", bson.M{"n": int32(1)}, bson.M{"$inc": bson.M{"n": int64(1)}}, bson.M{"n": int64(2)}},
+		{"$inc int64 by int32", bson.M{"n": int64(1)}, bson.M{"$inc": bson.M{"n": int32(1)}}, bson.M{"n": int64(2)}},
+		{"$inc int32 by double", bson.M{"n": int32(1)}, bson.M{"$inc": bson.M{"n": 0.5}}, bson.M{"n": 1.5}},
+		{"$inc double by int64", bson.M{"n": 1.5}, bson.M{"$inc": bson.M{"n": int64(1)}}, bson.M{"n": 2.5}},
+		{"$inc missing field", bson.M{}, bson.M{"$inc": bson.M{"n": int64(5)}}, bson.M{"n": int64(5)}},
+		{"$inc null field", bson.M{"n": nil}, bson.M{"$inc": bson.M{"n": int32(5)}}, bson.M{"n": int32(5)}},
+		{"$min lower", bson.M{"n": int32(5)}, bson.M{"$min": bson.M{"n": int32(3)}}, bson.M{"n": int32(3)}},
+		{"$min higher", bson.M{"n": int32(5)}, bson.M{"$min": bson.M{"n": int32(7)}}, bson.M{"n": int32(5)}},
+		{"$max higher", bson.M{"n": int32(5)}, bson.M{"$max": bson.M{"n": 7.5}}, bson.M{"n": 7.5}},
+		{"$max missing field", bson.M{}, bson.M{"$max": bson.M{"n": int32(1)}}, bson.M{"n": int32(1)}},
+		{"$push", bson.M{"a": bson.A{"x"}}, bson.M{"$push": bson.M{"a": "y"}}, bson.M{"a": bson.A{"x", "y"}}},
+		{"$push missing field", bson.M{}, bson.M{"$push": bson.M{"a": "y"}}, bson.M{"a": bson.A{"y"}}},
+		{"$push $each", bson.M{"a": bson.A{"x"}}, bson.M{"$push": bson.M{"a": bson.M{"$each": bson.A{"y", "z"}}}}, bson.M{"a": bson.A{"x", "y", "z"}}},
+		{"$setOnInsert ignored on update", bson.M{"a": int32(1)}, bson.M{"$setOnInsert": bson.M{"b": int32(2)}}, bson.M{"a": int32(1)}},
+		{"replacement keeps _id", bson.M{"a": int32(1), "b": int32(2)}, bson.M{"c": int32(3)}, bson.M{"c": int32(3)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.doc["_id"] = "doc"
+			var coll = newTestCollection(t, tt.doc)
+			var result, err = coll.UpdateOne(context.Background(), bson.M{"_id": "doc"}, tt.update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.MatchedCount != 1 {
+				t.Errorf("matched %d, want 1", result.MatchedCount)
+			}
+			tt.want["_id"] = "doc"
+			if got := findDoc(t, coll, bson.M{"_id": "doc"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	var tests = []struct {
+		name   string
+		update bson.M
+	}{
+		{"$inc on a string", bson.M{"$inc": bson.M{"s": int32(1)}}},
+		{"$inc by a string", bson.M{"$inc": bson.M{"n": "1"}}},
+		{"$push on a scalar", bson.M{"$push": bson.M{"n": int32(1)}}},
+		{"change of _id", bson.M{"$set": bson.M{"_id": "other"}}},
+		{"unsupported operator", bson.M{"$rename": bson.M{"n": "m"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var coll = newTestCollection(t, bson.M{"_id": "doc", "s": "x", "n": int32(1)})
+			if _, err := coll.UpdateOne(context.Background(), bson.M{"_id": "doc"}, tt.update); !errors.Is(err, errUnsupported) {
+				t.Errorf("got %v, want an unsupported error", err)
+			}
+			if got, want := findDoc(t, coll, bson.M{"_id": "doc"}), (bson.M{"_id": "doc", "s": "x", "n": int32(1)}); !reflect.DeepEqual(got, want) {
+				t.Errorf("document changed by a failed update: %v", got)
+			}
+		})
+	}
+}
+
+func TestUpdateCounts(t *testing.T) {
+	var coll = newTestCollection(t,
+		bson.M{"_id": int32(1), "g": "a", "n": int32(1)},
+		bson.M{"_id": int32(2), "g": "a", "n": int32(2)},
+		bson.M{"_id": int32(3), "g": "b", "n": int32(2)},
+	)
+	var tests = []struct {
+		name             string
+		multi            bool
+		filter, update   bson.M
+		matched, changed int64
+	}{
+		{"one of many", false, bson.M{"g": "a"}, bson.M{"$set": bson.M{"x": true}}, 1, 1},
+		{"many", true, bson.M{"g": "a"}, bson.M{"$set": bson.M{"x": true}}, 2, 1},
+		{"unchanged", true, bson.M{"n": int32(2)}, bson.M{"$set": bson.M{"n": int32(2)}}, 2, 0},
+		{"no match", true, bson.M{"g": "c"}, bson.M{"$set": bson.M{"x": true}}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result *mongo.UpdateResult
+			var err error
+			if tt.multi {
+				result, err = coll.UpdateMany(context.Background(), tt.filter, tt.update)
+			} else {
+				result, err = coll.UpdateOne(context.Background(), tt.filter, tt.update)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.MatchedCount != tt.matched || result.ModifiedCount != tt.changed || result.UpsertedCount != 0 {
+				t.Errorf("got matched %d modified %d upserted %d, want %d %d 0", result.MatchedCount, result.ModifiedCount, result.UpsertedCount, tt.matched, tt.changed)
+			}
+		})
+	}
+}
+
+func TestUpsertSeeding(t *testing.T) {
+	var tests = []struct {
+		name           string
+		filter, update bson.M
+		want           bson.M
+	}{
+		{"equality fields", bson.M{"_id": "u", "site": "a", "day": int32(1)}, bson.M{"$inc": bson.M{"hits": int32(1)}},
+			bson.M{"_id": "u", "site": "a", "day": int32(1), "hits": int32(1)}},
+		{"operators are not copied", bson.M{"_id": "u", "n": bson.M{"$gt": int32(5)}, "m": bson.M{"$eq": "x"}}, bson.M{"$set": bson.M{"k": true}},
+			bson.M{"_id": "u", "m": "x", "k": true}},
+		{"dotted fields", bson.M{"_id": "u", "a.b": int32(1)}, bson.M{"$set": bson.M{"a.c": int32(2)}},
+			bson.M{"_id": "u", "a": bson.M{"b": int32(1), "c": int32(2)}}},
+		{"$and clauses", bson.M{"$and": bson.A{bson.M{"_id": "u"}, bson.M{"x": int32(1)}}, "$or": bson.A{bson.M{"y": int32(1)}}}, bson.M{"$set": bson.M{"k": true}},
+			bson.M{"_id": "u", "x": int32(1), "k": true}},
+		{"$setOnInsert applied", bson.M{"_id": "u"}, bson.M{"$set": bson.M{"a": int32(1)}, "$setOnInsert": bson.M{"created": "now"}},
+			bson.M{"_id": "u", "a": int32(1), "created": "now"}},
+		{"update overrides filter", bson.M{"_id": "u", "a": int32(1)}, bson.M{"$set": bson.M{"a": int32(2)}},
+			bson.M{"_id": "u", "a": int32(2)}},
+		{"replacement", bson.M{"_id": "u", "a": int32(1)}, bson.M{"b": int32(2)},
+			bson.M{"_id": "u", "b": int32(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var coll = newTestCollection(t)
+			var result, err = coll.UpdateOne(context.Background(), tt.filter, tt.update, options.Update().SetUpsert(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.UpsertedCount != 1 || result.UpsertedID != "u" {
+				t.Errorf("got upserted %d id %v, want 1 u", result.UpsertedCount, result.UpsertedID)
+			}
+			if got := findDoc(t, coll, bson.M{"_id": "u"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpsertGeneratesID(t *testing.T) {
+	var coll = newTestCollection(t)
+	var result, err = coll.UpdateOne(context.Background(), bson.M{"site": "a"}, bson.M{"$set": bson.M{"n": int32(1)}}, options.Update().SetUpsert(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result.UpsertedID.(primitive.ObjectID); !ok {
+		t.Errorf("got upserted id %T, want ObjectID", result.UpsertedID)
+	}
+	// a second upsert matches the inserted document
+	result, err = coll.UpdateOne(context.Background(), bson.M{"site": "a"}, bson.M{"$inc": bson.M{"n": int32(1)}}, options.Update().SetUpsert(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MatchedCount != 1 || result.UpsertedCount != 0 {
+		t.Errorf("got matched %d upserted %d, want 1 0", result.MatchedCount, result.UpsertedCount)
+	}
+	if got := findDoc(t, coll, bson.M{"site": "a"})["n"]; got != int32(2) {
+		t.Errorf("got n %v, want 2", got)
+	}
+}
+
+func TestInsertDuplicates(t *testing.T) {
+	var tests = []struct {
+		name    string
+		ordered bool
+		want    []interface{}
+	}{
+		{"ordered stops at the duplicate", true, ids(int32(1), int32(2))},
+		{"unordered inserts the rest", false, ids(int32(1), int32(2), int32(3))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var coll = newTestCollection(t, bson.M{"_id": int32(1)})
+			var docs = []interface{}{bson.M{"_id": int32(2)}, bson.M{"_id": int32(1)}, bson.M{"_id": int32(3)}}
+			var _, err = coll.InsertMany(context.Background(), docs, options.InsertMany().SetOrdered(tt.ordered))
+			if !mongo.IsDuplicateKeyError(err) {
+				t.Errorf("got %v, want a duplicate key error", err)
+			}
+			if got := findIDs(t, coll, bson.M{}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var coll = newTestCollection(t, bson.M{"_id": int32(1)})
+	if _, err := coll.InsertOne(context.Background(), bson.M{"_id": 1.0}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("got %v, want a duplicate key error for the same number of another type", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	var tests = []struct {
+		name    string
+		multi   bool
+		filter  bson.M
+		deleted int64
+		left    []interface{}
+	}{
+		{"one", false, bson.M{"g": "a"}, 1, ids(int32(2), int32(3))},
+		{"many", true, bson.M{"g": "a"}, 2, ids(int32(3))},
+		{"none", true, bson.M{"g": "c"}, 0, ids(int32(1), int32(2), int32(3))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var coll = newTestCollection(t,
+				bson.M{"_id": int32(1), "g": "a"},
+				bson.M{"_id": int32(2), "g": "a"},
+				bson.M{"_id": int32(3), "g": "b"},
+			)
+			var result *mongo.DeleteResult
+			var err error
+			if tt.multi {
+				result, err = coll.DeleteMany(context.Background(), tt.filter)
+			} else {
+				result, err = coll.DeleteOne(context.Background(), tt.filter)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.DeletedCount != tt.deleted {
+				t.Errorf("deleted %d, want %d", result.DeletedCount, tt.deleted)
+			}
+			if got := findIDs(t, coll, bson.M{}); !reflect.DeepEqual(got, tt.left) {
+				t.Errorf("left %v, want %v", got, tt.left)
+			}
+		})
+	}
+}
+
+func TestFieldOrder(t *testing.T) {
+	var ctx = context.Background()
+	var coll = New("test").collection("items")
+	var doc = bson.D{{Key: "b", Value: int32(1)}, {Key: "a", Value: int32(2)}, {Key: "c", Value: bson.D{{Key: "z", Value: int32(3)}, {Key: "y", Value: int32(4)}}}}
+	var inserted, err = coll.InsertOne(ctx, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id = inserted.InsertedID
+
+	var findD = func(opts ...*options.FindOneOptions) bson.D {
+		t.Helper()
+		var got bson.D
+		if err := coll.FindOne(ctx, bson.M{}, opts...).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	var want = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	if got := findD(); !reflect.DeepEqual(got, want) {
+		t.Errorf("insert got %v, want %v", got, want)
+	}
+
+	// existing fields are replaced in place and new fields are appended
+	var update = bson.D{{Key: "$set", Value: bson.D{{Key: "d", Value: int32(5)}, {Key: "a", Value: int32(6)}, {Key: "c.x", Value: int32(7)}}}}
+	if _, err := coll.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		t.Fatal(err)
+	}
+	want = bson.D{
+		{Key: "_id", Value: id},
+		{Key: "b", Value: int32(1)},
+		{Key: "a", Value: int32(6)},
+		{Key: "c", Value: bson.D{{Key: "z", Value: int32(3)}, {Key: "y", Value: int32(4)}, {Key: "x", Value: int32(7)}}},
+		{Key: "d", Value: int32(5)},
+	}
+	if got := findD(); !reflect.DeepEqual(got, want) {
+		t.Errorf("$set got %v, want %v", got, want)
+	}
+
+	// an inclusion projection keeps the order of the document
+	var projection = bson.D{{Key: "d", Value: 1}, {Key: "c.y", Value: 1}, {Key: "b", Value: 1}}
+	want = bson.D{
+		{Key: "_id", Value: id},
+		{Key: "b", Value: int32(1)},
+		{Key: "c", Value: bson.D{{Key: "y", Value: int32(4)}}},
+		{Key: "d", Value: int32(5)},
+	}
+	if got := findD(options.FindOne().SetProjection(projection)); !reflect.DeepEqual(got, want) {
+		t.Errorf("projection got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,342 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const migrationsCollection = "_migrations"
+const migrationLockID = "lock"
+const defaultLockTTL = 5 * time.Minute
+
+// ErrMigrationLocked is returned when another process holds the migration lock
+var ErrMigrationLocked = errors.New("mongodb: migrations are locked by another process")
+
+// ErrMigrationLockLost is returned when the lock could not be extended or was
+// taken by another process while the migrations were running
+var ErrMigrationLockLost = errors.New("mongodb: migration lock was lost")
+
+// ErrMigrationNotRecorded is returned when a migration ran but the change of
+// its version could not be saved, the version has to be fixed by hand
+var ErrMigrationNotRecorded = errors.New("mongodb: migration ran but was not recorded")
+
+// ErrNoDownMigration is returned when a migration which has to be reverted has no Down func
+var ErrNoDownMigration = errors.New("mongodb: migration has no down func")
+
+// MigrationFunc is the func which applies or reverts a single migration
+type MigrationFunc func(ctx context.Context, db *mongo.Database) error
+
+// Migration struct contains a single versioned data migration
+type Migration struct {
+	Version     int64
+	Description string
+	Up, Down    MigrationFunc
+}
+
+// MigrationStatus struct contains the state of a registered migration
+type MigrationStatus struct {
+	Version     int64
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+	Duration    time.Duration
+}
+
+// MigrationOptions struct contains the options for the migration runner
+type MigrationOptions struct {
+	Collection string        // defaults to "_migrations"
+	LockTTL    time.Duration // lock expires after this time if the process dies
+	Owner      string        // identifies the lock holder, defaults to hostname
+	DryRun     bool          // report the migrations which would run without running them
+}
+
+// MigrationRunner applies the registered migrations and records the applied
+// versions so that each migration runs once in each environment
+type MigrationRunner struct {
+	db         *mongo.Database
+	coll       Collection
+	lockTTL    time.Duration
+	owner      string
+	dryRun     bool
+	migrations []Migration
+}
+
+type appliedMigration struct {
+	Version     int64     `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+	DurationMs  int64     `bson:"durationMs"`
+}
+
+// NewMigrationRunner method will return a runner which stores the applied
+// versions in the database of the client
+func NewMigrationRunner(client *Client, opts *MigrationOptions) *MigrationRunner {
+	if opts == nil {
+		opts = &MigrationOptions{}
+	}
+	var r = &MigrationRunner{db: client.GetDb(), lockTTL: opts.LockTTL, owner: opts.Owner, dryRun: opts.DryRun}
+	var collection = opts.Collection
+	if collection == "" {
+		collection = migrationsCollection
+	}
+	r.coll = NewDatabase(r.db).Collection(collection)
+	if r.lockTTL == 0 {
+		r.lockTTL = defaultLockTTL
+	}
+	if r.owner == "" {
+		var host, _ = os.Hostname()
+		r.owner = host + "-" + primitive.NewObjectID().Hex()
+	}
+	return r
+}
+
+// Register method will add the migrations to the runner, versions must be unique
+func (r *MigrationRunner) Register(migrations ...Migration) error {
+	for _, m := range migrations {
+		if m.Up == nil {
+			return fmt.Errorf("mongodb: migration %d has no up func", m.Version)
+		}
+		for _, existing := range r.migrations {
+			if existing.Version == m.Version {
+				return fmt.Errorf("mongodb: duplicate migration version %d", m.Version)
+			}
+		}
+		r.migrations = append(r.migrations, m)
+	}
+	sort.Slice(r.migrations, func(i, j int) bool {
+		return r.migrations[i].Version < r.migrations[j].Version
+	})
+	return nil
+}
+
+// Status method will return the status of all the registered migrations
+func (r *MigrationRunner) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var applied, err = r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result []MigrationStatus
+	for _, m := range r.migrations {
+		var status = MigrationStatus{Version: m.Version, Description: m.Description}
+		if a, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.AppliedAt
+			status.Duration = time.Duration(a.DurationMs) * time.Millisecond
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Up method will apply all the pending migrations in order of their version
+func (r *MigrationRunner) Up(ctx context.Context) ([]MigrationStatus, error) {
+	return r.UpTo(ctx, 0)
+}
+
+// UpTo method will apply the pending migrations till the given version, zero
+// means all the migrations. The migrations which were run (or would be run in
+// dry run mode) are returned
+func (r *MigrationRunner) UpTo(ctx context.Context, version int64) ([]MigrationStatus, error) {
+	var done []MigrationStatus
+	var err = r.withLock(ctx, func(ctx context.Context) error {
+		var applied, err = r.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range r.migrations {
+			if version > 0 && m.Version > version {
+				break
+			}
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			var status = MigrationStatus{Version: m.Version, Description: m.Description}
+			if !r.dryRun {
+				if err := r.checkLock(ctx); err != nil {
+					return err
+				}
+				var start = time.Now()
+				if err := m.Up(ctx, r.db); err != nil {
+					return fmt.Errorf("mongodb: migration %d up: %w", m.Version, err)
+				}
+				status.Applied = true
+				status.AppliedAt = start
+				status.Duration = time.Since(start)
+				var doc = appliedMigration{Version: m.Version, Description: m.Description, AppliedAt: start, DurationMs: status.Duration.Milliseconds()}
+				if err := r.record(func(ctx context.Context) error {
+					var _, err = r.coll.InsertOne(ctx, doc)
+					return err
+				}); err != nil {
+					return fmt.Errorf("%w: %d up: %v", ErrMigrationNotRecorded, m.Version, err)
+				}
+			}
+			done = append(done, status)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down method will revert the given number of last applied migrations
+func (r *MigrationRunner) Down(ctx context.Context, steps int) ([]MigrationStatus, error) {
+	var done []MigrationStatus
+	var err = r.withLock(ctx, func(ctx context.Context) error {
+		var applied, err = r.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(r.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			var m = r.migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("%w: %d", ErrNoDownMigration, m.Version)
+			}
+			var status = MigrationStatus{Version: m.Version, Description: m.Description, Applied: true}
+			if !r.dryRun {
+				if err := r.checkLock(ctx); err != nil {
+					return err
+				}
+				var start = time.Now()
+				if err := m.Down(ctx, r.db); err != nil {
+					return fmt.Errorf("mongodb: migration %d down: %w", m.Version, err)
+				}
+				if err := r.record(func(ctx context.Context) error {
+					var _, err = r.coll.DeleteOne(ctx, bson.M{"_id": m.Version})
+					return err
+				}); err != nil {
+					return fmt.Errorf("%w: %d down: %v", ErrMigrationNotRecorded, m.Version, err)
+				}
+				status.Applied = false
+				status.Duration = time.Since(start)
+			}
+			done = append(done, status)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// record saves the change of a migration which has already run, it does not use
+// the context of the lock since the migration must be recorded even when the
+// lock was lost while it was running
+func (r *MigrationRunner) record(fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return fn(ctx)
+}
+
+func (r *MigrationRunner) applied(ctx context.Context) (map[int64]appliedMigration, error) {
+	var cursor, err = r.coll.Find(ctx, bson.M{"_id": bson.M{"$ne": migrationLockID}})
+	if err != nil {
+		return nil, err
+	}
+	var docs []appliedMigration
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	var result = make(map[int64]appliedMigration)
+	for _, d := range docs {
+		result[d.Version] = d
+	}
+	return result, nil
+}
+
+// withLock runs fn while holding the lock document, the lock is extended in
+// background so that long running migrations do not lose it. The context of
+// fn is cancelled as soon as an extension fails since another process can
+// take the expired lock. Dry runs do not take the lock since they do not
+// change anything
+func (r *MigrationRunner) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.dryRun {
+		return fn(ctx)
+	}
+	if err := r.acquireLock(ctx); err != nil {
+		return err
+	}
+	lockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var lostMu sync.Mutex
+	var lostErr error
+	var quitChan = make(chan bool)
+	var doneChan = make(chan bool)
+	go func() {
+		defer close(doneChan)
+		var ticker = time.NewTicker(r.lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.acquireLock(lockCtx); err != nil {
+					lostMu.Lock()
+					lostErr = fmt.Errorf("%w: %v", ErrMigrationLockLost, err)
+					lostMu.Unlock()
+					cancel()
+					return
+				}
+			case <-quitChan:
+				return
+			}
+		}
+	}()
+
+	var err = fn(lockCtx)
+	close(quitChan)
+	<-doneChan
+	lostMu.Lock()
+	// the unrecorded migration is reported since it has to be fixed by hand
+	if lostErr != nil && !errors.Is(err, ErrMigrationNotRecorded) {
+		err = lostErr
+	}
+	lostMu.Unlock()
+
+	// release the lock even if the context of the caller has expired
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer releaseCancel()
+	r.coll.DeleteOne(releaseCtx, bson.M{"_id": migrationLockID, "owner": r.owner})
+	return err
+}
+
+// checkLock returns ErrMigrationLockLost when this runner no longer holds an
+// unexpired lock, it is called before running each migration
+func (r *MigrationRunner) checkLock(ctx context.Context) error {
+	var filter = bson.M{"_id": migrationLockID, "owner": r.owner, "expiresAt": bson.M{"$gt": time.Now()}}
+	var count, err = r.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrMigrationLockLost
+	}
+	return nil
+}
+
+// acquireLock takes the lock if it is free, expired or already held by this
+// runner. When another runner holds it the upsert fails with a duplicate key
+func (r *MigrationRunner) acquireLock(ctx context.Context) error {
+	var now = time.Now()
+	var filter = bson.M{
+		"_id": migrationLockID,
+		"$or": bson.A{
+			bson.M{"owner": r.owner},
+			bson.M{"expiresAt": bson.M{"$lt": now}},
+		},
+	}
+	var update = bson.M{"$set": bson.M{"owner": r.owner, "lockedAt": now, "expiresAt": now.Add(r.lockTTL)}}
+	var _, err = r.coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMigrationLocked
+	}
+	return err
+}
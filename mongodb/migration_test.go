@@ -0,0 +1,107 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lockCollection is the migrations collection with no applied versions, the
+// lock renewals fail after renewals calls and the inserts fail with insertErr
+type lockCollection struct {
+	Collection // the methods the runner does not use are left nil
+
+	mu        sync.Mutex
+	lockCalls int
+	renewals  int
+	insertErr error
+	inserted  []interface{}
+}
+
+func (c *lockCollection) UpdateOne(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lockCalls++
+	if c.lockCalls > c.renewals+1 {
+		return nil, errors.New("lock taken")
+	}
+	return &mongo.UpdateResult{MatchedCount: 1}, nil
+}
+
+func (c *lockCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	return 1, nil
+}
+
+func (c *lockCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (Cursor, error) {
+	return emptyCursor{}, nil
+}
+
+func (c *lockCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.insertErr != nil {
+		return nil, c.insertErr
+	}
+	c.inserted = append(c.inserted, document)
+	return &mongo.InsertOneResult{}, nil
+}
+
+func (c *lockCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return &mongo.DeleteResult{}, nil
+}
+
+type emptyCursor struct{}
+
+func (emptyCursor) Next(ctx context.Context) bool                      { return false }
+func (emptyCursor) Decode(val interface{}) error                       { return nil }
+func (emptyCursor) All(ctx context.Context, results interface{}) error { return nil }
+func (emptyCursor) Err() error                                         { return nil }
+func (emptyCursor) Close(ctx context.Context) error                    { return nil }
+
+func TestMigrationRecordedAfterLockLost(t *testing.T) {
+	var coll = &lockCollection{}
+	var runner = &MigrationRunner{coll: coll, lockTTL: 30 * time.Millisecond, owner: "test"}
+	runner.Register(Migration{Version: 1, Up: func(ctx context.Context, db *mongo.Database) error {
+		// the renewal fails while the migration runs and cancels the context
+		<-ctx.Done()
+		return nil
+	}})
+
+	var done, err = runner.Up(context.Background())
+	if !errors.Is(err, ErrMigrationLockLost) {
+		t.Errorf("got %v, want the lock lost error", err)
+	}
+	if len(coll.inserted) != 1 || len(done) != 1 {
+		t.Errorf("got %d inserted and %d done, want the applied migration recorded", len(coll.inserted), len(done))
+	}
+}
+
+func TestMigrationNotRecorded(t *testing.T) {
+	var coll = &lockCollection{renewals: 100, insertErr: errors.New("insert failed")}
+	var runner = &MigrationRunner{coll: coll, lockTTL: time.Minute, owner: "test"}
+	var ran []int64
+	var up = func(version int64) MigrationFunc {
+		return func(ctx context.Context, db *mongo.Database) error {
+			ran = append(ran, version)
+			return nil
+		}
+	}
+	runner.Register(Migration{Version: 1, Up: up(1)}, Migration{Version: 2, Up: up(2)})
+
+	var _, err = runner.Up(context.Background())
+	if !errors.Is(err, ErrMigrationNotRecorded) || !strings.Contains(err.Error(), ": 1 up:") {
+		t.Errorf("got %v, want the not recorded error naming version 1", err)
+	}
+	if len(ran) != 1 {
+		t.Errorf("got %v migrations run, want to stop after the unrecorded one", ran)
+	}
+}
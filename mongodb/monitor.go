@@ -0,0 +1,236 @@
+package mongodb
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const redactedValue = "?"
+const maxRedactedItems = 3 // arrays like inserted documents are cut after these items
+
+// MonitorOptions struct enables the command monitoring of the client
+type MonitorOptions struct {
+	SlowThreshold time.Duration // commands taking longer than this are logged, zero disables the log
+	OnSlowCommand func(SlowCommand)
+}
+
+// SlowCommand struct contains the information of a command which took more
+// than the slow threshold, the literal values of the command are redacted
+type SlowCommand struct {
+	Database   string
+	Collection string
+	Operation  string
+	Duration   time.Duration
+	Command    string
+	Failure    string
+}
+
+// CommandStat struct contains the aggregated stats of an operation on a collection
+type CommandStat struct {
+	Collection   string
+	Operation    string
+	Count        int64
+	Errors       int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+type startedCommand struct {
+	database, collection string
+	command              bson.Raw
+}
+
+type commandMonitor struct {
+	opts    MonitorOptions
+	pending sync.Map // request id => *startedCommand
+	mu      sync.Mutex
+	stats   map[string]*CommandStat
+}
+
+// AvgLatency method will return the average latency of the operation
+func (s CommandStat) AvgLatency() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Count)
+}
+
+func newCommandMonitor(opts *MonitorOptions) *commandMonitor {
+	var m = &commandMonitor{opts: *opts, stats: make(map[string]*CommandStat)}
+	if m.opts.OnSlowCommand == nil {
+		m.opts.OnSlowCommand = logSlowCommand
+	}
+	return m
+}
+
+func (m *commandMonitor) eventMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: m.started,
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			m.finished(e.CommandFinishedEvent, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			m.finished(e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+func (m *commandMonitor) started(ctx context.Context, e *event.CommandStartedEvent) {
+	var cmd = &startedCommand{database: e.DatabaseName, collection: commandCollection(e.CommandName, e.Command)}
+	if m.opts.SlowThreshold > 0 {
+		// the raw command is only valid during the callback so keep a copy
+		cmd.command = append(bson.Raw(nil), e.Command...)
+	}
+	m.pending.Store(e.RequestID, cmd)
+}
+
+func (m *commandMonitor) finished(e event.CommandFinishedEvent, failure string) {
+	var value, ok = m.pending.LoadAndDelete(e.RequestID)
+	if !ok {
+		return
+	}
+	var cmd = value.(*startedCommand)
+	var duration = time.Duration(e.DurationNanos)
+
+	var key = cmd.collection + "." + e.CommandName
+	m.mu.Lock()
+	var stat, found = m.stats[key]
+	if !found {
+		stat = &CommandStat{Collection: cmd.collection, Operation: e.CommandName}
+		m.stats[key] = stat
+	}
+	stat.Count++
+	if failure != "" {
+		stat.Errors++
+	}
+	stat.TotalLatency += duration
+	if duration > stat.MaxLatency {
+		stat.MaxLatency = duration
+	}
+	m.mu.Unlock()
+
+	if m.opts.SlowThreshold > 0 && duration >= m.opts.SlowThreshold {
+		m.opts.OnSlowCommand(SlowCommand{
+			Database:   cmd.database,
+			Collection: cmd.collection,
+			Operation:  e.CommandName,
+			Duration:   duration,
+			Command:    RedactCommand(cmd.command),
+			Failure:    failure,
+		})
+	}
+}
+
+func (m *commandMonitor) snapshot() []CommandStat {
+	m.mu.Lock()
+	var result = make([]CommandStat, 0, len(m.stats))
+	for _, s := range m.stats {
+		result = append(result, *s)
+	}
+	m.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Collection != result[j].Collection {
+			return result[i].Collection < result[j].Collection
+		}
+		return result[i].Operation < result[j].Operation
+	})
+	return result
+}
+
+func (m *commandMonitor) reset() {
+	m.mu.Lock()
+	m.stats = make(map[string]*CommandStat)
+	m.mu.Unlock()
+}
+
+// CommandStats method will return the aggregated stats per collection and
+// operation, nil is returned when monitoring is not enabled
+func (c *Client) CommandStats() []CommandStat {
+	if c.monitor == nil {
+		return nil
+	}
+	return c.monitor.snapshot()
+}
+
+// ResetCommandStats method will clear the aggregated stats
+func (c *Client) ResetCommandStats() {
+	if c.monitor != nil {
+		c.monitor.reset()
+	}
+}
+
+// commandCollection returns the collection on which the command runs, for most
+// commands it is the value of the first element eg: {find: "clicks"} and for
+// getMore it is in the collection field
+func commandCollection(name string, cmd bson.Raw) string {
+	if name == "getMore" {
+		if v, err := cmd.LookupErr("collection"); err == nil {
+			if s, ok := v.StringValueOK(); ok {
+				return s
+			}
+		}
+		return ""
+	}
+	var elems, err = cmd.Elements()
+	if err != nil || len(elems) == 0 {
+		return ""
+	}
+	if s, ok := elems[0].Value().StringValueOK(); ok {
+		return s
+	}
+	return ""
+}
+
+// RedactCommand method will return the extended json of the command with all
+// the literal values replaced by "?", the keys and operators are kept so that
+// the shape of the query is visible without leaking any data
+func RedactCommand(cmd bson.Raw) string {
+	var elems, err = cmd.Elements()
+	if err != nil || len(elems) == 0 {
+		return ""
+	}
+	var doc = bson.D{{Key: elems[0].Key(), Value: elems[0].Value()}}
+	for _, e := range elems[1:] {
+		if e.Key() == "lsid" || e.Key() == "$clusterTime" {
+			continue
+		}
+		doc = append(doc, bson.E{Key: e.Key(), Value: redactValue(e.Value())})
+	}
+	var result, _ = bson.MarshalExtJSON(doc, false, false)
+	return string(result)
+}
+
+func redactValue(v bson.RawValue) interface{} {
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		var doc = bson.D{}
+		var elems, _ = v.Document().Elements()
+		for _, e := range elems {
+			doc = append(doc, bson.E{Key: e.Key(), Value: redactValue(e.Value())})
+		}
+		return doc
+	case bsontype.Array:
+		var arr = bson.A{}
+		var values, _ = v.Array().Values()
+		for i, av := range values {
+			if i == maxRedactedItems {
+				arr = append(arr, "...")
+				break
+			}
+			arr = append(arr, redactValue(av))
+		}
+		return arr
+	}
+	return redactedValue
+}
+
+func logSlowCommand(s SlowCommand) {
+	log.Printf("mongodb: slow command %s on %s.%s took %s: %s", s.Operation, s.Database, s.Collection, s.Duration, s.Command)
+}
@@ -0,0 +1,62 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRedactCommand(t *testing.T) {
+	var tests = []struct {
+		name string
+		cmd  bson.D
+		want string
+	}{
+		{"find", bson.D{
+			{Key: "find", Value: "clicks"},
+			{Key: "filter", Value: bson.D{{Key: "site", Value: "a"}, {Key: "clicks", Value: bson.D{{Key: "$gt", Value: 10}}}}},
+			{Key: "limit", Value: 5},
+			{Key: "lsid", Value: bson.D{{Key: "id", Value: "session"}}},
+			{Key: "$clusterTime", Value: bson.D{{Key: "clusterTime", Value: 1}}},
+			{Key: "$db", Value: "test"},
+		}, `{"find":"clicks","filter":{"site":"?","clicks":{"$gt":"?"}},"limit":"?","$db":"?"}`},
+		{"insert cuts the documents", bson.D{
+			{Key: "insert", Value: "clicks"},
+			{Key: "documents", Value: bson.A{bson.D{{Key: "a", Value: 1}}, bson.D{{Key: "a", Value: 2}}, bson.D{{Key: "a", Value: 3}}, bson.D{{Key: "a", Value: 4}}}},
+		}, `{"insert":"clicks","documents":[{"a":"?"},{"a":"?"},{"a":"?"},"..."]}`},
+		{"aggregate keeps the operators", bson.D{
+			{Key: "aggregate", Value: "clicks"},
+			{Key: "pipeline", Value: bson.A{bson.D{{Key: "$match", Value: bson.D{{Key: "site", Value: bson.D{{Key: "$in", Value: bson.A{"a", "b"}}}}}}}}},
+		}, `{"aggregate":"clicks","pipeline":[{"$match":{"site":{"$in":["?","?"]}}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw, err = bson.Marshal(tt.cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := RedactCommand(raw); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := RedactCommand(nil); got != "" {
+		t.Errorf("empty command got %q", got)
+	}
+}
+
+func TestCommandCollection(t *testing.T) {
+	var find, _ = bson.Marshal(bson.D{{Key: "find", Value: "clicks"}})
+	var getMore, _ = bson.Marshal(bson.D{{Key: "getMore", Value: int64(12)}, {Key: "collection", Value: "views"}})
+	var ping, _ = bson.Marshal(bson.D{{Key: "ping", Value: 1}})
+	if got := commandCollection("find", find); got != "clicks" {
+		t.Errorf("find got %q", got)
+	}
+	if got := commandCollection("getMore", getMore); got != "views" {
+		t.Errorf("getMore got %q", got)
+	}
+	if got := commandCollection("ping", ping); got != "" {
+		t.Errorf("ping got %q", got)
+	}
+}
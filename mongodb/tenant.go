@@ -0,0 +1,293 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type tenantCtxKey struct{}
+
+// ErrUnknownTenant is returned when the tenant has no database mapped to it
+var ErrUnknownTenant = errors.New("mongodb: unknown tenant")
+
+// ErrRouterClosed is returned when the router is used after Close
+var ErrRouterClosed = errors.New("mongodb: tenant router is closed")
+
+// TenantConfig struct contains the database of a tenant, when URI is empty the
+// database is opened on the default client of the router
+type TenantConfig struct {
+	Database string // empty uses the database of the default or cluster client
+	URI      string
+}
+
+// TenantRouterOptions struct contains the options for routing the tenants
+type TenantRouterOptions struct {
+	Default *Client
+	Tenants map[string]TenantConfig
+	// Resolve is called for the tenants not present in Tenants, the result is
+	// not cached by the router
+	Resolve func(ctx context.Context, tenant string) (TenantConfig, error)
+	// ClientConfig is used for the clients of dedicated clusters
+	ClientConfig Config
+	// IdleTimeout removes the dedicated cluster clients not used for this long
+	// from the pool, zero keeps the clients open till the router is closed. The
+	// removed client is disconnected once it has no leases and was not used for
+	// another IdleTimeout, so the handles returned by DbFor keep working meanwhile
+	IdleTimeout time.Duration
+}
+
+// TenantRouter maps a tenant to its database and lazily creates a pooled
+// client for every dedicated cluster URI
+type TenantRouter struct {
+	opts     TenantRouterOptions
+	mu       sync.Mutex
+	clients  map[string]*tenantClient // keyed by URI
+	retired  []*tenantClient          // removed from the pool, waiting to be disconnected
+	closed   bool
+	quitChan chan bool
+	wg       sync.WaitGroup
+}
+
+type tenantClient struct {
+	ready    chan struct{}
+	client   *Client
+	err      error
+	lastUsed time.Time
+	refs     int // leases taken by Acquire and WithDb
+}
+
+// WithTenant method will return a context carrying the tenant id so that the
+// model code can call DbFor without knowing the tenant
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromContext method will return the tenant id stored in the context
+func TenantFromContext(ctx context.Context) (string, bool) {
+	var tenant, ok = ctx.Value(tenantCtxKey{}).(string)
+	return tenant, ok
+}
+
+// NewTenantRouter method will return a router, the idle eviction is started
+// when IdleTimeout is greater than zero
+func NewTenantRouter(opts *TenantRouterOptions) *TenantRouter {
+	if opts == nil {
+		opts = &TenantRouterOptions{}
+	}
+	var r = &TenantRouter{opts: *opts, clients: make(map[string]*tenantClient)}
+	if r.opts.IdleTimeout > 0 {
+		r.quitChan = make(chan bool)
+		r.wg.Add(1)
+		go r.evictIdle()
+	}
+	return r
+}
+
+// DbFor method will return the database of the tenant, when tenant is empty
+// it is taken from the context set by WithTenant. Use Acquire or WithDb when
+// the handle is kept for longer than IdleTimeout
+func (r *TenantRouter) DbFor(ctx context.Context, tenant string) (*mongo.Database, error) {
+	var db, release, err = r.Acquire(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return db, nil
+}
+
+// Acquire method will return the database of the tenant with a release func
+// which must be called once the database is no longer used, the client of
+// the database is never disconnected while it is leased
+func (r *TenantRouter) Acquire(ctx context.Context, tenant string) (*mongo.Database, func(), error) {
+	if tenant == "" {
+		tenant, _ = TenantFromContext(ctx)
+	}
+	var conf, err = r.tenantConfig(ctx, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conf.URI == "" {
+		if r.opts.Default == nil {
+			return nil, nil, ErrUnknownTenant
+		}
+		return tenantDatabase(r.opts.Default, conf.Database), func() {}, nil
+	}
+	tc, err := r.clientFor(ctx, conf.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	var release = func() {
+		once.Do(func() {
+			r.mu.Lock()
+			tc.refs--
+			tc.lastUsed = time.Now()
+			r.mu.Unlock()
+		})
+	}
+	return tenantDatabase(tc.client, conf.Database), release, nil
+}
+
+// tenantDatabase returns the named database of the client, the database the
+// client was configured with is used when the tenant does not name one
+func tenantDatabase(client *Client, name string) *mongo.Database {
+	if name == "" {
+		return client.db
+	}
+	return client.mclient.Database(name)
+}
+
+// WithDb method will run fn with the database of the tenant leased for the
+// duration of the call
+func (r *TenantRouter) WithDb(ctx context.Context, tenant string, fn func(db *mongo.Database) error) error {
+	var db, release, err = r.Acquire(ctx, tenant)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(db)
+}
+
+func (r *TenantRouter) tenantConfig(ctx context.Context, tenant string) (TenantConfig, error) {
+	if tenant == "" {
+		return TenantConfig{}, ErrUnknownTenant
+	}
+	if conf, ok := r.opts.Tenants[tenant]; ok {
+		return conf, nil
+	}
+	if r.opts.Resolve != nil {
+		return r.opts.Resolve(ctx, tenant)
+	}
+	return TenantConfig{}, ErrUnknownTenant
+}
+
+// clientFor returns the leased pooled client of the URI, concurrent callers
+// wait for the same connection instead of connecting twice
+func (r *TenantRouter) clientFor(ctx context.Context, uri string) (*tenantClient, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrRouterClosed
+	}
+	var tc, found = r.clients[uri]
+	if !found {
+		tc = &tenantClient{ready: make(chan struct{})}
+		r.clients[uri] = tc
+	}
+	tc.lastUsed = time.Now()
+	tc.refs++
+	r.mu.Unlock()
+
+	if !found {
+		tc.client, tc.err = NewClient(r.opts.ClientConfig, uri)
+		close(tc.ready)
+		if tc.err != nil {
+			r.mu.Lock()
+			delete(r.clients, uri)
+			r.mu.Unlock()
+		}
+	}
+
+	select {
+	case <-tc.ready:
+		if tc.err != nil {
+			r.unlease(tc)
+			return nil, tc.err
+		}
+		return tc, nil
+	case <-ctx.Done():
+		r.unlease(tc)
+		return nil, ctx.Err()
+	}
+}
+
+func (r *TenantRouter) unlease(tc *tenantClient) {
+	r.mu.Lock()
+	tc.refs--
+	r.mu.Unlock()
+}
+
+func (tc *tenantClient) isReady() bool {
+	select {
+	case <-tc.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// evictIdle removes the idle clients from the pool and disconnects the removed
+// clients once they have no leases and were not used for another IdleTimeout
+func (r *TenantRouter) evictIdle() {
+	defer r.wg.Done()
+	var ticker = time.NewTicker(r.opts.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			var idle []*Client
+			r.mu.Lock()
+			for uri, tc := range r.clients {
+				if tc.isReady() && tc.client != nil && tc.refs == 0 && time.Since(tc.lastUsed) > r.opts.IdleTimeout {
+					delete(r.clients, uri)
+					tc.lastUsed = time.Now()
+					r.retired = append(r.retired, tc)
+				}
+			}
+			var retired = r.retired[:0]
+			for _, tc := range r.retired {
+				if tc.refs == 0 && time.Since(tc.lastUsed) > r.opts.IdleTimeout {
+					idle = append(idle, tc.client)
+				} else {
+					retired = append(retired, tc)
+				}
+			}
+			r.retired = retired
+			r.mu.Unlock()
+			for _, c := range idle {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				c.Close(ctx)
+				cancel()
+			}
+		case <-r.quitChan:
+			return
+		}
+	}
+}
+
+// Close method will stop the eviction and disconnect all the dedicated cluster
+// clients, the default client is not closed
+func (r *TenantRouter) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	var clients = r.retired
+	for _, tc := range r.clients {
+		clients = append(clients, tc)
+	}
+	r.clients = make(map[string]*tenantClient)
+	r.retired = nil
+	r.mu.Unlock()
+
+	if r.quitChan != nil {
+		close(r.quitChan)
+		r.wg.Wait()
+	}
+	var lastErr error
+	for _, tc := range clients {
+		<-tc.ready
+		if tc.client != nil {
+			if err := tc.client.Close(ctx); err != nil {
+				lastErr = err
+			}
+		}
+	}
+	return lastErr
+}
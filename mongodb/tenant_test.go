@@ -0,0 +1,43 @@
+package mongodb
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestTenantRouterDefaultDatabase(t *testing.T) {
+	// the driver connects lazily so no server is needed to get the handles
+	var mclient, err = mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var router = NewTenantRouter(&TenantRouterOptions{
+		Default: &Client{mclient: mclient, db: mclient.Database("main")},
+		Tenants: map[string]TenantConfig{"shared": {}, "own": {Database: "own_db"}},
+	})
+	defer router.Close(context.Background())
+
+	var tests = []struct{ tenant, want string }{{"shared", "main"}, {"own", "own_db"}}
+	for _, tt := range tests {
+		var db, err = router.DbFor(context.Background(), tt.tenant)
+		if err != nil || db.Name() != tt.want {
+			t.Errorf("%s got %v %v, want %s", tt.tenant, db, err, tt.want)
+		}
+	}
+	if _, err := router.DbFor(context.Background(), "unknown"); err != ErrUnknownTenant {
+		t.Errorf("got %v, want ErrUnknownTenant", err)
+	}
+}
+
+func TestTenantRouterNilOptions(t *testing.T) {
+	var router = NewTenantRouter(nil)
+	if _, err := router.DbFor(WithTenant(context.Background(), "a"), ""); err != ErrUnknownTenant {
+		t.Errorf("got %v, want ErrUnknownTenant", err)
+	}
+	if err := router.Close(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
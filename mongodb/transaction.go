@@ -0,0 +1,111 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const defaultTransactionRetries = 3
+
+// ErrTransactionRetries is returned when the transaction still fails with a
+// transient error after MaxRetries
+var ErrTransactionRetries = errors.New("mongodb: transaction retries exhausted")
+
+// TransactionOptions struct contains the options with which the transactions
+// will be started, nil concerns fallback to the settings of the client
+type TransactionOptions struct {
+	ReadConcern    *readconcern.ReadConcern
+	WriteConcern   *writeconcern.WriteConcern
+	ReadPreference *readpref.ReadPref
+	MaxRetries     int           // number of times a transient failure is retried
+	RetryInterval  time.Duration // wait between the retries, doubled on each retry
+	MaxCommitTime  time.Duration
+}
+
+// TransactionFunc is the func which is run inside a transaction, all the
+// operations must use the session context to be part of the transaction
+type TransactionFunc func(sessCtx mongo.SessionContext) error
+
+// SetTransactionOptions method will set the default options used by WithTransaction
+func (c *Client) SetTransactionOptions(opts *TransactionOptions) {
+	c.txnOpts = opts
+}
+
+// WithTransaction method will run fn inside a transaction with the default
+// transaction options of the client
+func (c *Client) WithTransaction(ctx context.Context, fn TransactionFunc) error {
+	return c.WithTransactionOpts(ctx, c.txnOpts, fn)
+}
+
+// WithTransactionOpts method will start a session and run fn inside a transaction
+// with the WithTransaction of the driver, which aborts the failed attempts, retries
+// the commit on UnknownTransactionCommitResult and the whole transaction on
+// TransientTransactionError till the context expires. The transaction is run at most
+// MaxRetries more times with RetryInterval between them, ErrTransactionRetries is
+// returned once they are exhausted
+func (c *Client) WithTransactionOpts(ctx context.Context, opts *TransactionOptions, fn TransactionFunc) error {
+	if opts == nil {
+		opts = &TransactionOptions{}
+	}
+	var maxRetries = opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultTransactionRetries
+	}
+	var txnOpts = options.Transaction()
+	if opts.ReadConcern != nil {
+		txnOpts.SetReadConcern(opts.ReadConcern)
+	}
+	if opts.WriteConcern != nil {
+		txnOpts.SetWriteConcern(opts.WriteConcern)
+	}
+	if opts.ReadPreference != nil {
+		txnOpts.SetReadPreference(opts.ReadPreference)
+	}
+	if opts.MaxCommitTime > 0 {
+		txnOpts.SetMaxCommitTime(&opts.MaxCommitTime)
+	}
+
+	var session, err = c.mclient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	var interval = opts.RetryInterval
+	var attempt int
+	var lastErr error
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// the driver calls fn again only after a transient error
+		if attempt > 0 {
+			if attempt > maxRetries {
+				// the error is not wrapped so that the driver does not see the label and stops
+				return nil, fmt.Errorf("%w after %d attempts: %v", ErrTransactionRetries, attempt, lastErr)
+			}
+			if interval > 0 {
+				select {
+				case <-time.After(interval):
+					interval *= 2
+				case <-sessCtx.Done():
+					return nil, sessCtx.Err()
+				}
+			}
+		}
+		attempt++
+		lastErr = fn(sessCtx)
+		if lastErr == nil {
+			// the commit failed with a transient error when fn is called again
+			lastErr = errors.New("mongodb: transaction commit failed with a transient error")
+			return nil, nil
+		}
+		return nil, lastErr
+	}, txnOpts)
+	return err
+}
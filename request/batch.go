@@ -0,0 +1,224 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const defaultBatchConcurrency = 10
+
+// BatchMode decides what happens to the rest of the batch when a request fails
+type BatchMode int
+
+// Define the batch modes
+const (
+	// BatchCollectAll runs every request and returns all the errors
+	BatchCollectAll BatchMode = iota
+	// BatchFailFast cancels the pending requests after the first error
+	BatchFailFast
+)
+
+// ErrBatchAborted is the error of the requests which were not sent because
+// an earlier request of a fail fast batch failed
+var ErrBatchAborted = errors.New("request: batch aborted")
+
+// BatchOptions struct contains the limits of the batch
+type BatchOptions struct {
+	Concurrency int // requests in flight, default 10
+	PerHost     int // requests in flight to a single host, zero means only the global limit
+	// RatePerSecond limits the requests started per second, Burst requests can
+	// start at once. Zero disables the rate limit
+	RatePerSecond float64
+	Burst         int
+	Mode          BatchMode
+	// IsError decides if the result is a failure, by default only the errors
+	// are failures and the responses are returned as they are
+	IsError func(resp *Response, err error) bool
+}
+
+// BatchResult struct contains the result of a request of the batch
+type BatchResult struct {
+	Response *Response
+	Error    error
+}
+
+// BatchError struct is returned when requests of the batch fail, Failed
+// contains the indexes of the failed requests in order
+type BatchError struct {
+	Failed []int
+	Errors []error
+}
+
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Errors) == 1 {
+		return fmt.Sprintf("request: batch request %d failed: %v", e.Failed[0], e.Errors[0])
+	}
+	return fmt.Sprintf("request: %d batch requests failed, first %d: %v", len(e.Errors), e.Failed[0], e.Errors[0])
+}
+
+// Unwrap returns the first error so that errors.Is works with the batch error
+func (e *BatchError) Unwrap() error {
+	return e.Errors[0]
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait reserves a token and sleeps till it is available
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	var now = time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return ctx.Err()
+	}
+	return sleep(ctx, delay)
+}
+
+func hostOf(opts *RequestOptions) string {
+	var u, err = url.Parse(opts.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func acquire(ctx context.Context, sem chan struct{}) error {
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Batch method will send the requests with the limits of the options and
+// return the results in the order of the requests. The error is a *BatchError
+// when any request failed
+func (c *Client) Batch(ctx context.Context, requests []*RequestOptions, opts *BatchOptions) ([]BatchResult, error) {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	var concurrency = opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	var isError = opts.IsError
+	if isError == nil {
+		isError = func(resp *Response, err error) bool { return err != nil }
+	}
+	var limiter *rateLimiter
+	if opts.RatePerSecond > 0 {
+		limiter = newRateLimiter(opts.RatePerSecond, opts.Burst)
+	}
+	var hosts = make(map[string]chan struct{})
+	if opts.PerHost > 0 {
+		for _, r := range requests {
+			var host = hostOf(r)
+			if _, ok := hosts[host]; !ok {
+				hosts[host] = make(chan struct{}, opts.PerHost)
+			}
+		}
+	}
+
+	var parent = ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// aborted is true when the batch context was cancelled by a failure and
+	// not by the caller
+	var aborted = func() bool { return ctx.Err() != nil && parent.Err() == nil }
+	var global = make(chan struct{}, concurrency)
+	var results = make([]BatchResult, len(requests))
+	var failed = make([]bool, len(requests))
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// the host slot is taken first so that a busy host does not hold the global slots
+			if sem, ok := hosts[hostOf(requests[i])]; ok {
+				if err := acquire(ctx, sem); err != nil {
+					results[i].Error = err
+					return
+				}
+				defer func() { <-sem }()
+			}
+			if err := acquire(ctx, global); err != nil {
+				results[i].Error = err
+				return
+			}
+			defer func() { <-global }()
+			if limiter != nil {
+				if err := limiter.wait(ctx); err != nil {
+					results[i].Error = err
+					return
+				}
+			}
+			// the options are copied since RequestContext fills in the defaults
+			var copied = *requests[i]
+			var resp, err = c.RequestContext(ctx, &copied)
+			results[i] = BatchResult{Response: resp, Error: err}
+			if err != nil && ctx.Err() != nil {
+				// cut by the cancellation, not a failure of the request
+				return
+			}
+			if isError(resp, err) {
+				failed[i] = true
+				if opts.Mode == BatchFailFast {
+					cancel()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var batchErr = &BatchError{}
+	for i := range results {
+		if failed[i] {
+			if results[i].Error == nil && results[i].Response != nil {
+				results[i].Error = fmt.Errorf("request: unexpected response %d", results[i].Response.StatusCode)
+			}
+			batchErr.Failed = append(batchErr.Failed, i)
+			batchErr.Errors = append(batchErr.Errors, results[i].Error)
+		} else if results[i].Error != nil && aborted() {
+			// cancelled by the failure of another request
+			results[i].Error = ErrBatchAborted
+		}
+	}
+	if len(batchErr.Errors) > 0 {
+		return results, batchErr
+	}
+	for _, r := range results {
+		if r.Error != nil {
+			// the context of the caller was cancelled
+			return results, r.Error
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,173 @@
+package request
+
+import (
+	"context"
+	"errors"
+	netHttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// inflightServer records the highest number of requests it handled at once
+type inflightServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	inflight int
+	max      int
+}
+
+func newInflightServer(t *testing.T, delay time.Duration) *inflightServer {
+	var s = &inflightServer{}
+	s.Server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		s.mu.Lock()
+		s.inflight++
+		if s.inflight > s.max {
+			s.max = s.inflight
+		}
+		s.mu.Unlock()
+		time.Sleep(delay)
+		s.mu.Lock()
+		s.inflight--
+		s.mu.Unlock()
+		w.Write([]byte(r.URL.Query().Get("i")))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *inflightServer) maxInflight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.max
+}
+
+func serverError(resp *Response, err error) bool {
+	return err != nil || resp.StatusCode >= 500
+}
+
+func TestBatchCollectAll(t *testing.T) {
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(netHttp.StatusBadGateway)
+		}
+		w.Write([]byte(r.URL.Query().Get("i")))
+	}))
+	defer server.Close()
+	var requests []*RequestOptions
+	for i := 0; i < 6; i++ {
+		var query = map[string]string{"i": strconv.Itoa(i)}
+		if i%3 == 1 {
+			query["fail"] = "1"
+		}
+		requests = append(requests, &RequestOptions{URL: server.URL, Query: query})
+	}
+	var client = NewClient(&ClientOptions{})
+	var results, err = client.Batch(context.Background(), requests, &BatchOptions{Concurrency: 2, IsError: serverError})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 2 || batchErr.Failed[0] != 1 || batchErr.Failed[1] != 4 {
+		t.Fatalf("got %v, want the requests 1 and 4 failed", err)
+	}
+	for i, r := range results {
+		if r.Response == nil || r.Response.Body != strconv.Itoa(i) {
+			t.Errorf("result %d got %+v", i, r)
+		}
+		if (r.Error != nil) != (i%3 == 1) {
+			t.Errorf("result %d got error %v", i, r.Error)
+		}
+	}
+}
+
+func TestBatchFailFast(t *testing.T) {
+	// every request but the first one waits until it is cancelled
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		if r.URL.Query().Get("i") == "0" {
+			w.WriteHeader(netHttp.StatusInternalServerError)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	var requests []*RequestOptions
+	for i := 0; i < 20; i++ {
+		requests = append(requests, &RequestOptions{URL: server.URL, Query: map[string]string{"i": strconv.Itoa(i)}})
+	}
+	var client = NewClient(&ClientOptions{})
+	var start = time.Now()
+	var results, err = client.Batch(context.Background(), requests, &BatchOptions{Concurrency: 5, Mode: BatchFailFast, IsError: serverError})
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("the batch took %s, want the pending requests cancelled", time.Since(start))
+	}
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 1 || batchErr.Failed[0] != 0 {
+		t.Fatalf("got %v, want only the request 0 failed", err)
+	}
+	for i, r := range results[1:] {
+		if r.Error != ErrBatchAborted {
+			t.Errorf("result %d got %v, want ErrBatchAborted", i+1, r.Error)
+		}
+	}
+}
+
+func TestBatchLimits(t *testing.T) {
+	var first = newInflightServer(t, 20*time.Millisecond)
+	var second = newInflightServer(t, 20*time.Millisecond)
+	var requests []*RequestOptions
+	for i := 0; i < 8; i++ {
+		requests = append(requests, &RequestOptions{URL: first.URL}, &RequestOptions{URL: second.URL})
+	}
+	var client = NewClient(&ClientOptions{})
+
+	if _, err := client.Batch(context.Background(), requests, &BatchOptions{Concurrency: 10, PerHost: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if first.maxInflight() != 2 || second.maxInflight() != 2 {
+		t.Errorf("got %d and %d requests at once per host, want 2", first.maxInflight(), second.maxInflight())
+	}
+
+	var single = newInflightServer(t, 20*time.Millisecond)
+	requests = requests[:0]
+	for i := 0; i < 8; i++ {
+		requests = append(requests, &RequestOptions{URL: single.URL})
+	}
+	if _, err := client.Batch(context.Background(), requests, &BatchOptions{Concurrency: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if single.maxInflight() != 3 {
+		t.Errorf("got %d requests at once, want 3", single.maxInflight())
+	}
+}
+
+func TestBatchRateLimit(t *testing.T) {
+	var server = newInflightServer(t, 0)
+	var requests []*RequestOptions
+	for i := 0; i < 5; i++ {
+		requests = append(requests, &RequestOptions{URL: server.URL})
+	}
+	var client = NewClient(&ClientOptions{})
+	var start = time.Now()
+	if _, err := client.Batch(context.Background(), requests, &BatchOptions{RatePerSecond: 50, Burst: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// the first request uses the burst and the other four wait 20ms each
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("the batch took %s, want at least 80ms", elapsed)
+	}
+}
+
+func TestBatchCallerCancel(t *testing.T) {
+	var server = newInflightServer(t, 0)
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	var client = NewClient(&ClientOptions{})
+	var _, err = client.Batch(ctx, []*RequestOptions{{URL: server.URL}}, &BatchOptions{Mode: BatchFailFast})
+	var batchErr *BatchError
+	if !errors.Is(err, context.Canceled) || errors.As(err, &batchErr) {
+		t.Errorf("got %v, want the context error of the caller", err)
+	}
+}
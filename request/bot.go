@@ -0,0 +1,233 @@
+package request
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Define the bot categories
+const (
+	BotSearchEngine = "search"     // search engine crawlers eg: Googlebot
+	BotSocial       = "social"     // link preview fetchers eg: facebookexternalhit
+	BotSEO          = "seo"        // SEO and marketing crawlers eg: AhrefsBot
+	BotAI           = "ai"         // AI training and assistant crawlers eg: GPTBot
+	BotMonitoring   = "monitoring" // uptime and performance monitors eg: Pingdom
+	BotFeed         = "feed"       // feed readers and aggregators
+	BotLibrary      = "library"    // HTTP libraries and command line tools eg: curl
+	BotHeadless     = "headless"   // headless browsers and automation frameworks
+	BotGeneric      = "generic"    // identifies as a bot but is not in the signature list
+)
+
+// BotSignature struct matches a bot by a case insensitive substring of the
+// user agent, a pattern starting with ^ only matches the start of it
+type BotSignature struct {
+	Pattern  string `json:"pattern"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// defaultBotSignatures are checked in order, the first match wins so the
+// specific patterns must come before the broader ones
+var defaultBotSignatures = []BotSignature{
+	{"googlebot", "Googlebot", BotSearchEngine},
+	{"google-inspectiontool", "Google-InspectionTool", BotSearchEngine},
+	{"adsbot-google", "AdsBot-Google", BotSearchEngine},
+	{"mediapartners-google", "Mediapartners-Google", BotSearchEngine},
+	{"apis-google", "APIs-Google", BotSearchEngine},
+	{"bingbot", "Bingbot", BotSearchEngine},
+	{"bingpreview", "BingPreview", BotSearchEngine},
+	{"adidxbot", "AdIdxBot", BotSearchEngine},
+	{"msnbot", "MSNBot", BotSearchEngine},
+	{"yandex.com/bots", "YandexBot", BotSearchEngine},
+	{"baiduspider", "Baiduspider", BotSearchEngine},
+	{"duckduckbot", "DuckDuckBot", BotSearchEngine},
+	{"slurp", "Yahoo Slurp", BotSearchEngine},
+	{"applebot", "Applebot", BotSearchEngine},
+	{"sogou web spider", "Sogou Spider", BotSearchEngine},
+	{"exabot", "Exabot", BotSearchEngine},
+	{"seznambot", "SeznamBot", BotSearchEngine},
+	{"petalbot", "PetalBot", BotSearchEngine},
+	{"coccocbot", "CocCocBot", BotSearchEngine},
+	{"qwantify", "Qwantify", BotSearchEngine},
+
+	{"facebookexternalhit", "Facebook", BotSocial},
+	{"facebookcatalog", "Facebook Catalog", BotSocial},
+	{"twitterbot", "Twitterbot", BotSocial},
+	{"linkedinbot", "LinkedInBot", BotSocial},
+	{"slackbot", "Slackbot", BotSocial},
+	{"slack-imgproxy", "Slackbot", BotSocial},
+	{"discordbot", "Discordbot", BotSocial},
+	{"telegrambot", "TelegramBot", BotSocial},
+	// the in app browser of WhatsApp is a webview with a Mozilla user agent
+	{"^whatsapp/", "WhatsApp", BotSocial},
+	{"pinterestbot", "Pinterestbot", BotSocial},
+	{"redditbot", "Redditbot", BotSocial},
+	{"skypeuripreview", "Skype", BotSocial},
+	{"embedly", "Embedly", BotSocial},
+	{"vkshare", "VK", BotSocial},
+
+	{"gptbot", "GPTBot", BotAI},
+	{"chatgpt-user", "ChatGPT-User", BotAI},
+	{"oai-searchbot", "OAI-SearchBot", BotAI},
+	{"claudebot", "ClaudeBot", BotAI},
+	{"claude-web", "Claude-Web", BotAI},
+	{"anthropic-ai", "anthropic-ai", BotAI},
+	{"perplexitybot", "PerplexityBot", BotAI},
+	{"ccbot", "CCBot", BotAI},
+	{"bytespider", "Bytespider", BotAI},
+	{"amazonbot", "Amazonbot", BotAI},
+	{"cohere-ai", "cohere-ai", BotAI},
+
+	{"ahrefsbot", "AhrefsBot", BotSEO},
+	{"semrushbot", "SemrushBot", BotSEO},
+	{"mj12bot", "MJ12bot", BotSEO},
+	{"dotbot", "DotBot", BotSEO},
+	{"rogerbot", "Rogerbot", BotSEO},
+	{"screaming frog", "Screaming Frog", BotSEO},
+	{"blexbot", "BLEXBot", BotSEO},
+	{"serpstatbot", "SerpstatBot", BotSEO},
+	{"dataforseobot", "DataForSeoBot", BotSEO},
+	{"megaindex", "MegaIndex", BotSEO},
+
+	{"pingdom", "Pingdom", BotMonitoring},
+	{"uptimerobot", "UptimeRobot", BotMonitoring},
+	{"statuscake", "StatusCake", BotMonitoring},
+	{"site24x7", "Site24x7", BotMonitoring},
+	{"newrelicpinger", "New Relic", BotMonitoring},
+	{"datadog", "Datadog", BotMonitoring},
+	{"gtmetrix", "GTmetrix", BotMonitoring},
+	{"chrome-lighthouse", "Lighthouse", BotMonitoring},
+	{"elb-healthchecker", "ELB HealthChecker", BotMonitoring},
+	{"googlehc", "Google Health Check", BotMonitoring},
+	{"kube-probe", "Kubernetes Probe", BotMonitoring},
+	{"better uptime", "Better Uptime", BotMonitoring},
+
+	{"feedfetcher", "Feedfetcher", BotFeed},
+	{"feedly", "Feedly", BotFeed},
+	{"inoreader", "Inoreader", BotFeed},
+	{"newsblur", "NewsBlur", BotFeed},
+
+	{"headlesschrome", "HeadlessChrome", BotHeadless},
+	{"phantomjs", "PhantomJS", BotHeadless},
+	{"puppeteer", "Puppeteer", BotHeadless},
+	{"playwright", "Playwright", BotHeadless},
+	{"selenium", "Selenium", BotHeadless},
+	{"webdriver", "WebDriver", BotHeadless},
+	{"slimerjs", "SlimerJS", BotHeadless},
+	{"cypress", "Cypress", BotHeadless},
+
+	{"curl/", "curl", BotLibrary},
+	{"wget/", "Wget", BotLibrary},
+	{"python-requests", "python-requests", BotLibrary},
+	{"python-urllib", "Python-urllib", BotLibrary},
+	{"aiohttp", "aiohttp", BotLibrary},
+	{"httpx", "httpx", BotLibrary},
+	{"scrapy", "Scrapy", BotLibrary},
+	{"go-http-client", "Go-http-client", BotLibrary},
+	{"okhttp", "OkHttp", BotLibrary},
+	{"apache-httpclient", "Apache-HttpClient", BotLibrary},
+	{"java/", "Java", BotLibrary},
+	{"libwww-perl", "libwww-perl", BotLibrary},
+	{"php/", "PHP", BotLibrary},
+	{"guzzlehttp", "Guzzle", BotLibrary},
+	{"node-fetch", "node-fetch", BotLibrary},
+	{"axios", "axios", BotLibrary},
+	{"undici", "undici", BotLibrary},
+	{"postmanruntime", "Postman", BotLibrary},
+	{"insomnia", "Insomnia", BotLibrary},
+	{"httpie", "HTTPie", BotLibrary},
+	{"winhttp", "WinHTTP", BotLibrary},
+	{"powershell", "PowerShell", BotLibrary},
+	{"libcurl", "libcurl", BotLibrary},
+}
+
+// genericBotPatterns mark the user agent as bot when no signature matches
+var genericBotPatterns = []string{"bot/", "bot;", "bot)", "bot-", "bot_", "bot ", "robot", "crawler", "spider", "scraper", "http-client", "headless"}
+
+// genericBotExclusions are real devices and apps which match the generic patterns
+var genericBotExclusions = []string{"cubot"}
+
+var (
+	botMu         sync.RWMutex
+	botSignatures = defaultBotSignatures
+)
+
+func (s BotSignature) matches(lower string) bool {
+	if strings.HasPrefix(s.Pattern, "^") {
+		return strings.HasPrefix(lower, s.Pattern[1:])
+	}
+	return strings.Contains(lower, s.Pattern)
+}
+
+// BotSignatures method will return a copy of the signature list in use
+func BotSignatures() []BotSignature {
+	botMu.RLock()
+	defer botMu.RUnlock()
+	return append([]BotSignature(nil), botSignatures...)
+}
+
+// SetBotSignatures method will replace the signature list, nil restores the default list
+func SetBotSignatures(signatures []BotSignature) {
+	if signatures == nil {
+		signatures = defaultBotSignatures
+	}
+	var normalised = make([]BotSignature, 0, len(signatures))
+	for _, s := range signatures {
+		if s.Pattern == "" {
+			continue
+		}
+		s.Pattern = strings.ToLower(s.Pattern)
+		normalised = append(normalised, s)
+	}
+	botMu.Lock()
+	botSignatures = normalised
+	botMu.Unlock()
+	// the memoised devices were detected with the old list
+	PurgeUACache()
+}
+
+// AddBotSignatures method will add the signatures before the current ones so
+// that they take precedence
+func AddBotSignatures(signatures ...BotSignature) {
+	SetBotSignatures(append(append([]BotSignature(nil), signatures...), BotSignatures()...))
+}
+
+// LoadBotSignatures method will replace the signature list with the JSON array
+// read from r eg: [{"pattern":"mybot","name":"MyBot","category":"generic"}]
+func LoadBotSignatures(r io.Reader) error {
+	var signatures []BotSignature
+	if err := json.NewDecoder(r).Decode(&signatures); err != nil {
+		return err
+	}
+	SetBotSignatures(signatures)
+	return nil
+}
+
+// DetectBot function returns the name and category of the bot, ok is false
+// when the user agent looks like a browser. An empty user agent is a bot of
+// the library category since every browser sends one
+func DetectBot(ua string) (name, category string, ok bool) {
+	var lower = strings.ToLower(strings.TrimSpace(ua))
+	if lower == "" {
+		return "", BotLibrary, true
+	}
+	botMu.RLock()
+	var signatures = botSignatures
+	botMu.RUnlock()
+	for _, s := range signatures {
+		if s.matches(lower) {
+			return s.Name, s.Category, true
+		}
+	}
+	for _, e := range genericBotExclusions {
+		lower = strings.ReplaceAll(lower, e, "")
+	}
+	for _, p := range genericBotPatterns {
+		if strings.Contains(lower, p) || strings.HasSuffix(lower, strings.TrimRight(p, "/;)-_ ")) {
+			return "", BotGeneric, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,227 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of the circuit of a host
+type BreakerState int
+
+// Define the circuit breaker states
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+const defaultOpenTimeout = 30 * time.Second
+const defaultBreakerWindow = time.Minute
+const defaultConsecutiveFailures = 5
+
+// ErrCircuitOpen is returned without making the request when the circuit of the host is open
+var ErrCircuitOpen = errors.New("request: circuit breaker is open")
+
+// BreakerOptions struct contains the options of the per host circuit breaker.
+// The circuit trips when either of ConsecutiveFailures or FailureRatio is reached,
+// ConsecutiveFailures defaults to 5 when neither is set
+type BreakerOptions struct {
+	ConsecutiveFailures int
+	FailureRatio        float64       // ratio of failed requests in the window eg: 0.5
+	MinRequests         int           // requests needed in the window before the ratio is checked
+	Window              time.Duration // the counts used for the ratio are reset after every window
+	OpenTimeout         time.Duration // time after which an open circuit lets a probe request through
+	HalfOpenRequests    int           // concurrent probes allowed in half open state
+	// IsFailure decides if the result counts as failure, by default transport
+	// errors and 5xx responses are failures except the requests cancelled by the caller
+	IsFailure     func(statusCode int, err error) bool
+	OnStateChange func(host string, from, to BreakerState)
+}
+
+// CircuitBreaker keeps a circuit for every host
+type CircuitBreaker struct {
+	opts     BreakerOptions
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of a host, the generation changes with every state
+// change and new window so that the results of the requests allowed before
+// are not counted again
+type circuit struct {
+	state       BreakerState
+	generation  uint64
+	consecutive int
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probes      int
+}
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// NewCircuitBreaker method will return a breaker with the defaults filled in
+func NewCircuitBreaker(opts *BreakerOptions) *CircuitBreaker {
+	var b = &CircuitBreaker{opts: *opts, circuits: make(map[string]*circuit)}
+	if b.opts.OpenTimeout == 0 {
+		b.opts.OpenTimeout = defaultOpenTimeout
+	}
+	if b.opts.Window == 0 {
+		b.opts.Window = defaultBreakerWindow
+	}
+	if b.opts.HalfOpenRequests == 0 {
+		b.opts.HalfOpenRequests = 1
+	}
+	if b.opts.ConsecutiveFailures == 0 && b.opts.FailureRatio == 0 {
+		b.opts.ConsecutiveFailures = defaultConsecutiveFailures
+	}
+	if b.opts.IsFailure == nil {
+		b.opts.IsFailure = func(statusCode int, err error) bool {
+			if errors.Is(err, context.Canceled) {
+				return false
+			}
+			return err != nil || statusCode >= 500
+		}
+	}
+	return b
+}
+
+// State method will return the current state of the circuit of the host
+func (b *CircuitBreaker) State(host string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.circuits[host]; ok {
+		return c.state
+	}
+	return StateClosed
+}
+
+// Allow method will return ErrCircuitOpen if the request to host must not be
+// made, every allowed request must be followed by a call to Record with the
+// returned generation
+func (b *CircuitBreaker) Allow(host string) (uint64, error) {
+	b.mu.Lock()
+	var c = b.circuit(host)
+	var from = c.state
+	b.advance(c)
+	var err error
+	switch c.state {
+	case StateOpen:
+		err = ErrCircuitOpen
+	case StateHalfOpen:
+		if c.probes >= b.opts.HalfOpenRequests {
+			err = ErrCircuitOpen
+		} else {
+			c.probes++
+		}
+	}
+	var to, generation = c.state, c.generation
+	b.mu.Unlock()
+	b.notify(host, from, to)
+	return generation, err
+}
+
+// Record method will record the result of a request allowed by Allow, the
+// result is ignored when the circuit changed since the request was allowed
+func (b *CircuitBreaker) Record(host string, generation uint64, statusCode int, err error) {
+	var failed = b.opts.IsFailure(statusCode, err)
+	b.mu.Lock()
+	var c = b.circuit(host)
+	var from = c.state
+	b.advance(c)
+	if generation != c.generation {
+		var to = c.state
+		b.mu.Unlock()
+		b.notify(host, from, to)
+		return
+	}
+	switch c.state {
+	case StateHalfOpen:
+		c.probes--
+		if failed {
+			b.open(c)
+		} else {
+			b.reset(c)
+		}
+	case StateClosed:
+		c.requests++
+		if failed {
+			c.failures++
+			c.consecutive++
+		} else {
+			c.consecutive = 0
+		}
+		if failed && b.shouldTrip(c) {
+			b.open(c)
+		}
+	}
+	var to = c.state
+	b.mu.Unlock()
+	b.notify(host, from, to)
+}
+
+func (b *CircuitBreaker) shouldTrip(c *circuit) bool {
+	if b.opts.ConsecutiveFailures > 0 && c.consecutive >= b.opts.ConsecutiveFailures {
+		return true
+	}
+	if b.opts.FailureRatio > 0 && c.requests >= b.opts.MinRequests {
+		return float64(c.failures)/float64(c.requests) >= b.opts.FailureRatio
+	}
+	return false
+}
+
+// advance moves an open circuit to half open after the timeout and starts a
+// new window of a closed circuit, it must be called with the lock held
+func (b *CircuitBreaker) advance(c *circuit) {
+	switch {
+	case c.state == StateOpen && time.Since(c.openedAt) >= b.opts.OpenTimeout:
+		c.state = StateHalfOpen
+		c.probes = 0
+		c.generation++
+	case c.state == StateClosed && time.Since(c.windowStart) > b.opts.Window:
+		c.windowStart = time.Now()
+		c.requests, c.failures = 0, 0
+		c.generation++
+	}
+}
+
+func (b *CircuitBreaker) open(c *circuit) {
+	c.state = StateOpen
+	c.openedAt = time.Now()
+	c.probes = 0
+	c.generation++
+}
+
+func (b *CircuitBreaker) reset(c *circuit) {
+	c.state = StateClosed
+	c.consecutive, c.requests, c.failures, c.probes = 0, 0, 0, 0
+	c.windowStart = time.Now()
+	c.generation++
+}
+
+// circuit must be called with the lock held
+func (b *CircuitBreaker) circuit(host string) *circuit {
+	var c, ok = b.circuits[host]
+	if !ok {
+		c = &circuit{windowStart: time.Now()}
+		b.circuits[host] = c
+	}
+	return c
+}
+
+func (b *CircuitBreaker) notify(host string, from, to BreakerState) {
+	if from != to && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(host, from, to)
+	}
+}
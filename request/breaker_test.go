@@ -0,0 +1,147 @@
+package request
+
+import (
+	"errors"
+	netHttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testHost = "api.example.com"
+
+// expire moves the open circuit of the host past the open timeout
+func expire(b *CircuitBreaker, host string) {
+	b.mu.Lock()
+	b.circuits[host].openedAt = time.Now().Add(-b.opts.OpenTimeout)
+	b.mu.Unlock()
+}
+
+func allow(t *testing.T, b *CircuitBreaker) uint64 {
+	t.Helper()
+	var generation, err = b.Allow(testHost)
+	if err != nil {
+		t.Fatalf("got %v, want the request allowed in %s", err, b.State(testHost))
+	}
+	return generation
+}
+
+func TestBreakerStateMachine(t *testing.T) {
+	var changes []string
+	var b = NewCircuitBreaker(&BreakerOptions{
+		ConsecutiveFailures: 2,
+		HalfOpenRequests:    1,
+		OnStateChange: func(host string, from, to BreakerState) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	})
+	var failure = errors.New("connection refused")
+
+	// closed to open
+	b.Record(testHost, allow(t, b), 0, failure)
+	b.Record(testHost, allow(t, b), 200, nil)
+	b.Record(testHost, allow(t, b), 500, nil)
+	if b.State(testHost) != StateClosed {
+		t.Fatal("a success must reset the consecutive failures")
+	}
+	b.Record(testHost, allow(t, b), 503, nil)
+	if _, err := b.Allow(testHost); err != ErrCircuitOpen {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+
+	// open to half open lets one probe through, a failed probe opens again
+	expire(b, testHost)
+	var probe = allow(t, b)
+	if _, err := b.Allow(testHost); err != ErrCircuitOpen {
+		t.Fatalf("second probe got %v, want ErrCircuitOpen", err)
+	}
+	b.Record(testHost, probe, 0, failure)
+	if b.State(testHost) != StateOpen {
+		t.Fatalf("failed probe got %s, want open", b.State(testHost))
+	}
+
+	// a successful probe closes the circuit
+	expire(b, testHost)
+	b.Record(testHost, allow(t, b), 200, nil)
+	if b.State(testHost) != StateClosed {
+		t.Fatalf("successful probe got %s, want closed", b.State(testHost))
+	}
+
+	var want = []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got changes %v, want %v", changes, want)
+	}
+}
+
+func TestBreakerIgnoresStaleResults(t *testing.T) {
+	var b = NewCircuitBreaker(&BreakerOptions{ConsecutiveFailures: 1})
+	var slow = allow(t, b)
+	b.Record(testHost, allow(t, b), 500, nil)
+
+	// the slow request was allowed while closed, its success must not be
+	// taken as the result of the probe
+	expire(b, testHost)
+	var probe = allow(t, b)
+	b.Record(testHost, slow, 200, nil)
+	if b.State(testHost) != StateHalfOpen {
+		t.Fatalf("stale success got %s, want half-open", b.State(testHost))
+	}
+	if _, err := b.Allow(testHost); err != ErrCircuitOpen {
+		t.Fatalf("stale result released the probe slot: %v", err)
+	}
+	b.Record(testHost, probe, 500, nil)
+	if b.State(testHost) != StateOpen {
+		t.Errorf("failed probe got %s, want open", b.State(testHost))
+	}
+}
+
+func TestBreakerDefaults(t *testing.T) {
+	var b = NewCircuitBreaker(&BreakerOptions{})
+	for i := 1; i <= defaultConsecutiveFailures; i++ {
+		b.Record(testHost, allow(t, b), 500, nil)
+		if open := b.State(testHost) == StateOpen; open != (i == defaultConsecutiveFailures) {
+			t.Fatalf("after %d failures got %s", i, b.State(testHost))
+		}
+	}
+
+	// only the ratio is checked when it is set
+	b = NewCircuitBreaker(&BreakerOptions{FailureRatio: 0.5, MinRequests: 4})
+	for i := 0; i < 3; i++ {
+		b.Record(testHost, allow(t, b), 500, nil)
+	}
+	if b.State(testHost) != StateClosed {
+		t.Fatal("the ratio must wait for MinRequests")
+	}
+	b.Record(testHost, allow(t, b), 200, nil)
+	if b.State(testHost) != StateClosed {
+		t.Fatal("the ratio is checked on failures only")
+	}
+	b.Record(testHost, allow(t, b), 500, nil)
+	if b.State(testHost) != StateOpen {
+		t.Errorf("4 of 5 failed got %s, want open", b.State(testHost))
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	var hits int32
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(netHttp.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var client = NewClient(&ClientOptions{Breaker: &BreakerOptions{ConsecutiveFailures: 2}})
+	for i := 0; i < 2; i++ {
+		if resp, err := client.Request(&RequestOptions{URL: server.URL}); err != nil || resp.StatusCode != 500 {
+			t.Fatalf("got %v %v", resp, err)
+		}
+	}
+	if _, err := client.Request(&RequestOptions{URL: server.URL}); err != ErrCircuitOpen {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+	if hits != 2 {
+		t.Errorf("server got %d requests, want 2", hits)
+	}
+}
@@ -0,0 +1,267 @@
+package request
+
+import (
+	netHttp "net/http"
+	"strconv"
+	"strings"
+)
+
+// Define the client hint headers
+const (
+	HintUA                = "Sec-CH-UA"
+	HintUAFullVersionList = "Sec-CH-UA-Full-Version-List"
+	HintUAFullVersion     = "Sec-CH-UA-Full-Version"
+	HintMobile            = "Sec-CH-UA-Mobile"
+	HintModel             = "Sec-CH-UA-Model"
+	HintPlatform          = "Sec-CH-UA-Platform"
+	HintPlatformVersion   = "Sec-CH-UA-Platform-Version"
+	HintArch              = "Sec-CH-UA-Arch"
+	HintBitness           = "Sec-CH-UA-Bitness"
+)
+
+// highEntropyHints are sent by the browser only after the server asks for them with Accept-CH
+var highEntropyHints = []string{HintUAFullVersionList, HintModel, HintPlatformVersion, HintArch, HintBitness}
+
+// Brand struct is an entry of the Sec-CH-UA brand lists
+type Brand struct {
+	Name, Version string
+}
+
+// ClientHints struct contains the parsed User-Agent client hints
+type ClientHints struct {
+	Brands          []Brand
+	FullVersionList []Brand
+	Mobile          bool
+	HasMobile       bool // false when Sec-CH-UA-Mobile was not sent
+	Model           string
+	Platform        string
+	PlatformVersion string
+	Arch            string
+	Bitness         string
+}
+
+// AcceptCH method will return the value of the Accept-CH header which asks the
+// browser for the hints used by ParseUAWithHints
+func AcceptCH() string {
+	return strings.Join(highEntropyHints, ", ")
+}
+
+// SetAcceptCH method will set the Accept-CH header on the response headers,
+// the browser sends the hints from the next request onwards
+func SetAcceptCH(header netHttp.Header) {
+	header.Set("Accept-CH", AcceptCH())
+}
+
+// parseSFString removes the quotes of a structured field string
+func parseSFString(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var unquoted strings.Builder
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && i+1 < len(value)-1 {
+			i++
+		}
+		unquoted.WriteByte(value[i])
+	}
+	return unquoted.String()
+}
+
+// splitSF splits the structured field on sep outside the quoted strings since
+// the brand names can contain commas and semicolons eg: "Not)A;Brand"
+func splitSF(value string, sep byte) []string {
+	var parts []string
+	var inQuote, escaped bool
+	var start int
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case value[i] == '\\' && inQuote:
+			escaped = true
+		case value[i] == '"':
+			inQuote = !inQuote
+		case value[i] == sep && !inQuote:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// parseBrands parses the brand list eg: "Chromium";v="112", "Not:A-Brand";v="99"
+func parseBrands(value string) []Brand {
+	var brands []Brand
+	for _, item := range splitSF(value, ',') {
+		var params = splitSF(item, ';')
+		var brand = Brand{Name: parseSFString(params[0])}
+		if brand.Name == "" {
+			continue
+		}
+		for _, p := range params[1:] {
+			var kv = strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && kv[0] == "v" {
+				brand.Version = parseSFString(kv[1])
+			}
+		}
+		brands = append(brands, brand)
+	}
+	return brands
+}
+
+// ParseClientHints function returns the client hints of the request headers,
+// nil is returned when the browser did not send any
+func ParseClientHints(header netHttp.Header) *ClientHints {
+	if header.Get(HintUA) == "" && header.Get(HintPlatform) == "" && header.Get(HintMobile) == "" {
+		return nil
+	}
+	var hints = &ClientHints{
+		Brands:          parseBrands(header.Get(HintUA)),
+		FullVersionList: parseBrands(header.Get(HintUAFullVersionList)),
+		Model:           parseSFString(header.Get(HintModel)),
+		Platform:        parseSFString(header.Get(HintPlatform)),
+		PlatformVersion: parseSFString(header.Get(HintPlatformVersion)),
+		Arch:            parseSFString(header.Get(HintArch)),
+		Bitness:         parseSFString(header.Get(HintBitness)),
+	}
+	switch strings.TrimSpace(header.Get(HintMobile)) {
+	case "?1":
+		hints.Mobile, hints.HasMobile = true, true
+	case "?0":
+		hints.HasMobile = true
+	}
+	// the deprecated full version header only carries the version of the main brand
+	if len(hints.FullVersionList) == 0 {
+		if full := parseSFString(header.Get(HintUAFullVersion)); full != "" {
+			if b, ok := hints.mainBrand(hints.Brands); ok {
+				hints.FullVersionList = []Brand{{Name: b.Name, Version: full}}
+			}
+		}
+	}
+	return hints
+}
+
+// isGreaseBrand reports the fake brands added by the browsers so that the
+// servers do not rely on the order of the list eg: "Not:A-Brand"
+func isGreaseBrand(name string) bool {
+	var lower = strings.ToLower(name)
+	return strings.Contains(lower, "not") && strings.Contains(lower, "brand")
+}
+
+// mainBrand returns the browser brand, Chromium is used only when the browser
+// does not send its own brand
+func (h *ClientHints) mainBrand(brands []Brand) (Brand, bool) {
+	var chromium Brand
+	var found bool
+	for _, b := range brands {
+		if isGreaseBrand(b.Name) {
+			continue
+		}
+		if b.Name == "Chromium" {
+			chromium, found = b, true
+			continue
+		}
+		return b, true
+	}
+	return chromium, found
+}
+
+// Browser method will return the browser name and full version, the full
+// version list is preferred over the major versions of Sec-CH-UA
+func (h *ClientHints) Browser() (string, string) {
+	if b, ok := h.mainBrand(h.FullVersionList); ok {
+		return browserName(b.Name), b.Version
+	}
+	if b, ok := h.mainBrand(h.Brands); ok {
+		return browserName(b.Name), b.Version
+	}
+	return "", ""
+}
+
+func browserName(brand string) string {
+	switch brand {
+	case "Google Chrome":
+		return "Chrome"
+	case "Microsoft Edge":
+		return "Edge"
+	}
+	return brand
+}
+
+// OS method will return the OS name and version in the format of Device, the
+// Windows platform version is mapped to the marketing version eg: 13.0.0 is Windows 11
+func (h *ClientHints) OS() (string, string) {
+	var name = h.Platform
+	switch name {
+	case "macOS":
+		name = "Mac OS"
+	case "Chrome OS", "Chromium OS":
+		// the spelling of the user agent parser
+		name = "ChromeOS"
+	}
+	if h.PlatformVersion == "" {
+		return name, ""
+	}
+	var parts = strings.Split(h.PlatformVersion, ".")
+	var major, _ = strconv.Atoi(parts[0])
+	var minor int
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+	if name == "Windows" {
+		switch {
+		case major >= 13:
+			major, minor = 11, 0
+		case major >= 1:
+			major, minor = 10, 0
+		case minor == 3:
+			major, minor = 8, 1
+		case minor == 2:
+			major, minor = 8, 0
+		default:
+			major, minor = 7, 0
+		}
+	}
+	return name, strconv.Itoa(major) + "." + strconv.Itoa(minor)
+}
+
+// ParseUAWithHints function returns the device of the user agent with the
+// browser, OS, model and mobile flag overridden by the client hints of the
+// request headers when they are present
+func ParseUAWithHints(ua string, header netHttp.Header) *Device {
+	var device = ParseUA(ua)
+	var hints = ParseClientHints(header)
+	if hints == nil {
+		return device
+	}
+	device.mergeHints(hints)
+	return device
+}
+
+func (d *Device) mergeHints(hints *ClientHints) {
+	if name, version := hints.Browser(); name != "" {
+		d.Browser = name
+		if major := strings.SplitN(version, ".", 2)[0]; major != "" && major != "0" {
+			d.Browser += " " + major
+		}
+		if strings.Contains(version, ".") {
+			d.BrowserVersion = version
+		}
+	}
+	if osName, osVersion := hints.OS(); osName != "" {
+		// the version of the user agent is kept only when the platform is the same
+		if osVersion != "" || osName != d.OSName {
+			d.OSVersion = osVersion
+		}
+		d.OSName = osName
+		d.OS = strings.TrimSpace(d.OSName + " " + d.OSVersion)
+	}
+	if hints.Model != "" {
+		d.Vendor, d.Model = androidVendor(hints.Model)
+	}
+	// Sec-CH-UA-Mobile is false for tablets as well so only true is trusted
+	if hints.Mobile {
+		d.Type = mobile
+	}
+}
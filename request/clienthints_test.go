@@ -0,0 +1,162 @@
+package request
+
+import (
+	netHttp "net/http"
+	"reflect"
+	"testing"
+)
+
+const (
+	chromeUA  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36"
+	androidUA = "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Mobile Safari/537.36"
+)
+
+func TestParseBrands(t *testing.T) {
+	var tests = []struct {
+		name, value string
+		want        []Brand
+	}{
+		{"chrome 116", `"Chromium";v="116", "Not)A;Brand";v="24", "Google Chrome";v="116"`,
+			[]Brand{{"Chromium", "116"}, {"Not)A;Brand", "24"}, {"Google Chrome", "116"}}},
+		{"edge 116", `"Chromium";v="116", "Not)A;Brand";v="24", "Microsoft Edge";v="116"`,
+			[]Brand{{"Chromium", "116"}, {"Not)A;Brand", "24"}, {"Microsoft Edge", "116"}}},
+		{"brave 116", `"Chromium";v="116", "Not)A;Brand";v="24", "Brave";v="116"`,
+			[]Brand{{"Chromium", "116"}, {"Not)A;Brand", "24"}, {"Brave", "116"}}},
+		{"chrome 112", `"Chromium";v="112", "Google Chrome";v="112", "Not:A-Brand";v="99"`,
+			[]Brand{{"Chromium", "112"}, {"Google Chrome", "112"}, {"Not:A-Brand", "99"}}},
+		{"chrome 102", `" Not A;Brand";v="99", "Chromium";v="102", "Google Chrome";v="102"`,
+			[]Brand{{" Not A;Brand", "99"}, {"Chromium", "102"}, {"Google Chrome", "102"}}},
+		{"full version list", `"Chromium";v="116.0.5845.96", "Not)A;Brand";v="24.0.0.0", "Google Chrome";v="116.0.5845.96"`,
+			[]Brand{{"Chromium", "116.0.5845.96"}, {"Not)A;Brand", "24.0.0.0"}, {"Google Chrome", "116.0.5845.96"}}},
+		{"comma and escapes in the name", `"A, \"B\"";v="1";x=2, "C"`,
+			[]Brand{{`A, "B"`, "1"}, {"C", ""}}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBrands(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientHintsBrowser(t *testing.T) {
+	var tests = []struct {
+		name           string
+		header         map[string]string
+		brand, version string
+	}{
+		{"chrome", map[string]string{HintUA: `"Chromium";v="116", "Not)A;Brand";v="24", "Google Chrome";v="116"`}, "Chrome", "116"},
+		{"edge", map[string]string{HintUA: `"Chromium";v="116", "Not)A;Brand";v="24", "Microsoft Edge";v="116"`}, "Edge", "116"},
+		{"brave", map[string]string{HintUA: `"Chromium";v="116", "Not)A;Brand";v="24", "Brave";v="116"`}, "Brave", "116"},
+		{"chromium only", map[string]string{HintUA: `"Not)A;Brand";v="24", "Chromium";v="116"`}, "Chromium", "116"},
+		{"full version list", map[string]string{
+			HintUA:                `"Chromium";v="116", "Not)A;Brand";v="24", "Google Chrome";v="116"`,
+			HintUAFullVersionList: `"Chromium";v="116.0.5845.96", "Not)A;Brand";v="24.0.0.0", "Google Chrome";v="116.0.5845.96"`,
+		}, "Chrome", "116.0.5845.96"},
+		{"deprecated full version", map[string]string{
+			HintUA:            `"Chromium";v="116", "Not)A;Brand";v="24", "Microsoft Edge";v="116"`,
+			HintUAFullVersion: `"116.0.1938.54"`,
+		}, "Edge", "116.0.1938.54"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header = netHttp.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			var name, version = ParseClientHints(header).Browser()
+			if name != tt.brand || version != tt.version {
+				t.Errorf("got %q %q, want %q %q", name, version, tt.brand, tt.version)
+			}
+		})
+	}
+}
+
+func TestClientHintsOS(t *testing.T) {
+	var tests = []struct {
+		platform, version string
+		name, want        string
+	}{
+		{`"Windows"`, `"15.0.0"`, "Windows", "11.0"},
+		{`"Windows"`, `"10.0.0"`, "Windows", "10.0"},
+		{`"Windows"`, `"0.3.0"`, "Windows", "8.1"},
+		{`"Windows"`, `"0.1.0"`, "Windows", "7.0"},
+		{`"macOS"`, `"13.5.1"`, "Mac OS", "13.5"},
+		{`"Android"`, `"13.0.0"`, "Android", "13.0"},
+		{`"Chrome OS"`, `"14541.0.0"`, "ChromeOS", "14541.0"},
+		{`"Chromium OS"`, "", "ChromeOS", ""},
+		{`"Linux"`, "", "Linux", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform+tt.version, func(t *testing.T) {
+			var header = netHttp.Header{}
+			header.Set(HintPlatform, tt.platform)
+			if tt.version != "" {
+				header.Set(HintPlatformVersion, tt.version)
+			}
+			var name, version = ParseClientHints(header).OS()
+			if name != tt.name || version != tt.want {
+				t.Errorf("got %q %q, want %q %q", name, version, tt.name, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClientHintsWithoutHints(t *testing.T) {
+	if hints := ParseClientHints(netHttp.Header{"Accept": {"*/*"}}); hints != nil {
+		t.Errorf("got %+v, want nil", hints)
+	}
+}
+
+func TestParseUAWithHints(t *testing.T) {
+	var header = netHttp.Header{}
+	header.Set(HintUA, `"Chromium";v="116", "Not)A;Brand";v="24", "Microsoft Edge";v="116"`)
+	header.Set(HintUAFullVersionList, `"Chromium";v="116.0.5845.97", "Not)A;Brand";v="24.0.0.0", "Microsoft Edge";v="116.0.1938.54"`)
+	header.Set(HintMobile, "?0")
+	header.Set(HintPlatform, `"Windows"`)
+	header.Set(HintPlatformVersion, `"15.0.0"`)
+
+	var device = ParseUAWithHints(chromeUA, header)
+	if device.Browser != "Edge 116" || device.BrowserVersion != "116.0.1938.54" {
+		t.Errorf("got browser %q %q, want Edge 116 116.0.1938.54", device.Browser, device.BrowserVersion)
+	}
+	if device.OSName != "Windows" || device.OSVersion != "11.0" {
+		t.Errorf("got os %q %q, want Windows 11.0", device.OSName, device.OSVersion)
+	}
+	// the cached device of the user agent must not be changed by the hints
+	if cached := ParseUA(chromeUA); cached.Browser == device.Browser {
+		t.Errorf("the hints leaked into the cached device %+v", cached)
+	}
+}
+
+func TestParseUAWithHintsModel(t *testing.T) {
+	var header = netHttp.Header{}
+	header.Set(HintUA, `"Chromium";v="116", "Not)A;Brand";v="24", "Google Chrome";v="116"`)
+	header.Set(HintMobile, "?1")
+	header.Set(HintPlatform, `"Android"`)
+	header.Set(HintModel, `"SM-S911B"`)
+
+	var device = ParseUAWithHints(androidUA, header)
+	if device.Vendor != "Samsung" || device.Model != "SM-S911B" {
+		t.Errorf("got %q %q, want Samsung SM-S911B", device.Vendor, device.Model)
+	}
+	if device.Type != mobile {
+		t.Errorf("got type %q, want %q", device.Type, mobile)
+	}
+}
+
+func TestParseUAWithHintsChromeOS(t *testing.T) {
+	var ua = "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36"
+	var header = netHttp.Header{}
+	header.Set(HintUA, `"Chromium";v="116", "Google Chrome";v="116"`)
+	header.Set(HintPlatform, `"Chrome OS"`)
+
+	var device = ParseUAWithHints(ua, header)
+	var parsed = ParseUA(ua)
+	// the platform is the same so the version of the user agent is kept
+	if device.OSName != "ChromeOS" || device.OSName != parsed.OSName || device.OSVersion != parsed.OSVersion || device.OS != parsed.OS {
+		t.Errorf("got os %q %q, want %q %q", device.OSName, device.OSVersion, parsed.OSName, parsed.OSVersion)
+	}
+}
@@ -1,6 +1,7 @@
 package request
 
 import (
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -11,31 +12,164 @@ import (
 const desktop = "desktop"
 const mobile = "mobile"
 const tablet = "tablet"
+const tv = "tv"
+const console = "console"
+const wearable = "wearable"
+const unknown = "unknown"
 
 // Device struct returns the information about the device by parsing the user agent
 type Device struct {
 	Type, Browser string
 	OS, OSName    string
 	OSVersion     string
+	// BrowserVersion is the full version eg: 112.0.5615.138
+	BrowserVersion string
+	Engine         string // Blink, WebKit, Gecko, Trident, EdgeHTML or Presto
+	EngineVersion  string
+	Vendor         string // eg: Samsung, Apple
+	Model          string // eg: SM-G991B, iPhone
+	// App is the app whose in-app browser made the request eg: Facebook,
+	// Instagram or WebView for the unknown Android apps
+	App       string
+	IsWebView bool
+	// IsBot is true for crawlers, monitors, HTTP libraries and headless
+	// browsers, BotName is empty when the bot is not in the signature list
+	IsBot       bool
+	BotCategory string
+	BotName     string
 }
 
-func getBrowser(uaInfo *uasurfer.UserAgent) string {
-	var browser = uaInfo.Browser.Name.String()
-	if len(browser) > 7 { // because device.Browser = "BrowserChrome" remove the prefix
-		browser = browser[7:]
+type uaPattern struct {
+	pattern, name string
+}
+
+// webViewApps are checked in order, the generic Android webview marker is the last
+var webViewApps = []uaPattern{
+	{"fban/", "Facebook"}, {"fbav/", "Facebook"}, {"fb_iab/", "Facebook"}, {"fbios", "Facebook"},
+	{"messengerforios", "Messenger"}, {"orca-android", "Messenger"},
+	{"instagram", "Instagram"},
+	{"musical_ly", "TikTok"}, {"bytedancewebview", "TikTok"}, {"tiktok", "TikTok"},
+	{"snapchat", "Snapchat"},
+	{"twitter for", "Twitter"}, {"twitterandroid", "Twitter"},
+	{"pinterest for", "Pinterest"},
+	{"linkedinapp", "LinkedIn"},
+	{"micromessenger", "WeChat"},
+	{" line/", "LINE"},
+	{"gsa/", "Google App"},
+	{"whatsapp", "WhatsApp"},
+	{"telegram", "Telegram"},
+	{"; wv)", "WebView"},
+}
+
+// tvPatterns mark the smart TVs and streaming devices with their vendor
+var tvPatterns = []uaPattern{
+	{"smart-tv", "Samsung"}, {"smarttv", ""},
+	{"web0s", "LG"}, {"netcast", "LG"},
+	{"bravia", "Sony"}, {"appletv", "Apple"}, {"apple tv", "Apple"},
+	{"crkey", "Google"}, {"googletv", "Google"}, {"android tv", ""},
+	{"roku", "Roku"}, {"; aft", "Amazon"}, {"hbbtv", ""}, {"vidaa", "Hisense"},
+}
+
+var consolePatterns = []uaPattern{
+	{"playstation", "Sony"}, {"xbox", "Microsoft"}, {"nintendo", "Nintendo"},
+}
+
+var wearablePatterns = []uaPattern{
+	{"watch os", "Apple"}, {"watchos", "Apple"}, {"wear os", ""}, {"sm-r8", "Samsung"}, {"sm-r9", "Samsung"},
+}
+
+// androidVendors maps the prefix of the Android model to the vendor
+var androidVendors = []uaPattern{
+	{"sm-", "Samsung"}, {"gt-", "Samsung"}, {"samsung", "Samsung"},
+	{"pixel", "Google"}, {"nexus", "Google"},
+	{"redmi", "Xiaomi"}, {"mi ", "Xiaomi"}, {"poco", "Xiaomi"}, {"xiaomi", "Xiaomi"},
+	{"cph", "OPPO"}, {"oppo", "OPPO"}, {"rmx", "Realme"},
+	{"vivo", "vivo"}, {"oneplus", "OnePlus"}, {"moto", "Motorola"}, {"xt1", "Motorola"},
+	{"nokia", "Nokia"}, {"huawei", "Huawei"}, {"honor", "Honor"},
+	{"lm-", "LG"}, {"lg-", "LG"}, {"infinix", "Infinix"}, {"tecno", "TECNO"}, {"itel", "itel"},
+	{"kf", "Amazon"}, {"aft", "Amazon"}, {"lenovo", "Lenovo"}, {"asus", "ASUS"}, {"zenfone", "ASUS"},
+}
+
+// browserTokens are the tokens which carry the full version of the browser,
+// "version/" is tried after them for every browser but Chrome
+var browserTokens = map[uasurfer.BrowserName][]string{
+	uasurfer.BrowserChrome:    {"crios/", "chrome/", "crmo/"},
+	uasurfer.BrowserFirefox:   {"fxios/", "firefox/"},
+	uasurfer.BrowserIE:        {"edge/", "msie ", "rv:"},
+	uasurfer.BrowserOpera:     {"opr/", "opios/", "opera/"},
+	uasurfer.BrowserSamsung:   {"samsungbrowser/"},
+	uasurfer.BrowserYandex:    {"yabrowser/"},
+	uasurfer.BrowserUCBrowser: {"ucbrowser/"},
+	uasurfer.BrowserSilk:      {"silk/"},
+	uasurfer.BrowserQQ:        {"qq/", "qqbrowser/"},
+	uasurfer.BrowserSpotify:   {"spotify/"},
+	uasurfer.BrowserCocCoc:    {"coc_coc_browser/"},
+}
+
+var androidModelRe = regexp.MustCompile(`(?i)android [\d.]+;(?: [a-z]{2}[-_][a-z]{2};)? ([^;)]+?)(?: build/[^;)]*)?(?:;|\))`)
+var versionRe = regexp.MustCompile(`^[\d.]+`)
+
+func matchPattern(lower string, patterns []uaPattern) (uaPattern, bool) {
+	for _, p := range patterns {
+		if strings.Contains(lower, p.pattern) {
+			return p, true
+		}
 	}
-	var version = uaInfo.Browser.Version.Major
-	if version > 0 {
-		browser += " " + strconv.Itoa(version)
+	return uaPattern{}, false
+}
+
+// tokenVersion returns the version after the token eg: "chrome/" in "Chrome/112.0.1"
+func tokenVersion(ua, token string) string {
+	var i = strings.Index(strings.ToLower(ua), token)
+	if i < 0 {
+		return ""
 	}
-	return browser
+	return versionRe.FindString(ua[i+len(token):])
 }
 
-func getOS(uaInfo *uasurfer.UserAgent) (string, string, string) {
-	var os = uaInfo.OS.Name.String()
-	if len(os) > 2 { // because device.OS = "OSMacOSX" remove the prefix "OS"
-		os = os[2:]
+func browserLabel(name string, major int) string {
+	if major > 0 {
+		return name + " " + strconv.Itoa(major)
+	}
+	return name
+}
+
+func getBrowser(uaInfo *uasurfer.UserAgent, ua string) (string, string) {
+	// uasurfer reports the chromium based Edge as Chrome
+	for _, token := range []string{"edg/", "edga/", "edgios/"} {
+		if version := tokenVersion(ua, token); version != "" {
+			var major, _ = strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+			return browserLabel("Edge", major), version
+		}
 	}
+	var browser = strings.TrimPrefix(uaInfo.Browser.Name.String(), "Browser")
+	var major = uaInfo.Browser.Version.Major
+	if major == 0 {
+		return browser, ""
+	}
+	// the version is taken as written in the user agent since uasurfer fills
+	// the missing components with zeros
+	var tokens = browserTokens[uaInfo.Browser.Name]
+	if uaInfo.Browser.Name != uasurfer.BrowserChrome {
+		tokens = append(tokens[:len(tokens):len(tokens)], "version/")
+	}
+	var majorString = strconv.Itoa(major)
+	for _, token := range tokens {
+		var full = strings.TrimSuffix(tokenVersion(ua, token), ".")
+		if full == majorString || strings.HasPrefix(full, majorString+".") {
+			return browserLabel(browser, major), full
+		}
+	}
+	// without a token uasurfer reports the OS version for Safari eg: in the
+	// in-app browsers of iOS, it is not the version of the browser
+	if uaInfo.Browser.Name == uasurfer.BrowserSafari {
+		return browser, ""
+	}
+	return browserLabel(browser, major), ""
+}
+
+func getOS(uaInfo *uasurfer.UserAgent) (string, string, string) {
+	var os = strings.TrimPrefix(uaInfo.OS.Name.String(), "OS")
 	if os == "MacOSX" {
 		os = "Mac OS"
 	}
@@ -47,27 +181,148 @@ func getOS(uaInfo *uasurfer.UserAgent) (string, string, string) {
 	return os, osName, osVersion
 }
 
-func getDeviceType(uaInfo *uasurfer.UserAgent) string {
-	var deviceType = uaInfo.DeviceType.String()
-	deviceType = deviceType[6:]
+func getEngine(ua, lower string) (string, string) {
+	switch {
+	case strings.Contains(lower, "edge/"):
+		return "EdgeHTML", tokenVersion(ua, "edge/")
+	case strings.Contains(lower, "trident/"):
+		return "Trident", tokenVersion(ua, "trident/")
+	case strings.Contains(lower, "presto/"):
+		return "Presto", tokenVersion(ua, "presto/")
+	case strings.Contains(lower, "applewebkit/") && strings.Contains(lower, "chrome/"):
+		// Blink has the version of Chrome
+		return "Blink", tokenVersion(ua, "chrome/")
+	case strings.Contains(lower, "applewebkit/"):
+		return "WebKit", tokenVersion(ua, "applewebkit/")
+	case strings.Contains(lower, "gecko/") && strings.Contains(lower, "rv:"):
+		return "Gecko", tokenVersion(ua, "rv:")
+	}
+	return "", ""
+}
 
-	if deviceType == "Computer" {
-		deviceType = desktop
-	} else if deviceType == "Phone" {
-		deviceType = mobile
+func getDeviceType(uaInfo *uasurfer.UserAgent, lower string) string {
+	switch {
+	case matches(lower, tvPatterns):
+		return tv
+	case matches(lower, consolePatterns):
+		return console
+	case matches(lower, wearablePatterns):
+		return wearable
+	}
+	switch uaInfo.DeviceType {
+	case uasurfer.DeviceComputer:
+		return desktop
+	case uasurfer.DevicePhone:
+		return mobile
+	case uasurfer.DeviceTablet:
+		return tablet
+	case uasurfer.DeviceConsole:
+		return console
+	case uasurfer.DeviceWearable:
+		return wearable
+	case uasurfer.DeviceTV:
+		return tv
 	}
+	return unknown
+}
 
-	return strings.ToLower(deviceType)
+func matches(lower string, patterns []uaPattern) bool {
+	var _, ok = matchPattern(lower, patterns)
+	return ok
 }
 
-// ParseUA function returns a device struct containing the parsed user agent info
-func ParseUA(ua string) *Device {
+func getVendorModel(uaInfo *uasurfer.UserAgent, ua, lower string) (string, string) {
+	switch uaInfo.OS.Platform {
+	case uasurfer.PlatformiPhone:
+		return "Apple", "iPhone"
+	case uasurfer.PlatformiPad:
+		return "Apple", "iPad"
+	case uasurfer.PlatformiPod:
+		return "Apple", "iPod"
+	case uasurfer.PlatformMac:
+		return "Apple", "Macintosh"
+	}
+	if uaInfo.OS.Name != uasurfer.OSAndroid {
+		// the TVs and consoles which do not run Android send only the vendor
+		for _, patterns := range [][]uaPattern{tvPatterns, consolePatterns, wearablePatterns} {
+			if p, ok := matchPattern(lower, patterns); ok && p.name != "" {
+				return p.name, ""
+			}
+		}
+		return "", ""
+	}
+	var m = androidModelRe.FindStringSubmatch(ua)
+	if m == nil {
+		return "", ""
+	}
+	var model = strings.TrimSpace(m[1])
+	// Chrome freezes the model to "K" and old user agents send "U" or the language
+	if len(model) <= 2 || strings.EqualFold(model, "wv") || strings.EqualFold(model, "mobile") {
+		return "", ""
+	}
+	return androidVendor(model)
+}
+
+// androidVendor returns the vendor of the Android model and the model without
+// the vendor name eg: "SAMSUNG SM-G991B" is Samsung SM-G991B
+func androidVendor(model string) (string, string) {
+	var lowerModel = strings.ToLower(model)
+	var p uaPattern
+	for _, v := range androidVendors {
+		if strings.HasPrefix(lowerModel, v.pattern) {
+			p = v
+			break
+		}
+	}
+	if p.name == "" {
+		return "", model
+	}
+	var fields = strings.Fields(model)
+	if len(fields) > 1 && strings.EqualFold(fields[0], p.name) {
+		model = strings.TrimSpace(model[len(fields[0]):])
+	}
+	return p.name, model
+}
+
+// getWebView only looks at the browser user agents since the apps send their
+// own user agent eg: WhatsApp/2.23.20.0 when they fetch the link previews
+func getWebView(lower string) (string, bool) {
+	if !strings.HasPrefix(lower, "mozilla/") {
+		return "", false
+	}
+	if p, ok := matchPattern(lower, webViewApps); ok {
+		return p.name, true
+	}
+	return "", false
+}
+
+// parseUA parses the user agent without the cache
+func parseUA(ua string) *Device {
 	var uaInfo = uasurfer.Parse(ua)
+	var lower = strings.ToLower(ua)
 
 	var device = &Device{}
-	device.Type = getDeviceType(uaInfo)
-	device.Browser = getBrowser(uaInfo)
+	device.Type = getDeviceType(uaInfo, lower)
+	device.Browser, device.BrowserVersion = getBrowser(uaInfo, ua)
 	device.OS, device.OSName, device.OSVersion = getOS(uaInfo)
+	device.Engine, device.EngineVersion = getEngine(ua, lower)
+	device.Vendor, device.Model = getVendorModel(uaInfo, ua, lower)
+	device.App, device.IsWebView = getWebView(lower)
+	device.BotName, device.BotCategory, device.IsBot = DetectBot(ua)
+	if !device.IsBot && uaInfo.IsBot() {
+		device.IsBot, device.BotCategory = true, BotGeneric
+	}
+	return device
+}
 
+// ParseUA function returns a device struct containing the parsed user agent
+// info, the results are memoised in an LRU cache and a copy is returned so
+// the caller can modify it
+func ParseUA(ua string) *Device {
+	if device, ok := uaCache.get(ua); ok {
+		return &device
+	}
+	var device = parseUA(ua)
+	uaCache.add(ua, *device)
 	return device
 }
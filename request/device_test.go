@@ -0,0 +1,28 @@
+package request
+
+import "testing"
+
+func TestParseUABrowserVersion(t *testing.T) {
+	var tests = []struct {
+		name, ua         string
+		browser, version string
+	}{
+		{"chrome", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.5845.97 Safari/537.36", "Chrome 116", "116.0.5845.97"},
+		{"edge", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36 Edg/116.0.1938.54", "Edge 116", "116.0.1938.54"},
+		{"firefox", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/117.0", "Firefox 117", "117.0"},
+		{"internet explorer", "Mozilla/5.0 (Windows NT 10.0; Trident/7.0; rv:11.0) like Gecko", "IE 11", "11.0"},
+		{"safari", "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1", "Safari 16", "16.5"},
+		{"kindle silk", "Mozilla/5.0 (Linux; Android 9; KFTRWI) AppleWebKit/537.36 (KHTML, like Gecko) Silk/116.5.1 like Chrome/116.0.5845.114 Safari/537.36", "Silk 116", "116.5.1"},
+		{"old kindle silk", "Mozilla/5.0 (Linux; U; Android 4.0.3; en-us; KFTT Build/IML74K) AppleWebKit/535.19 (KHTML, like Gecko) Silk/3.4 Mobile Safari/535.19 Silk-Accelerated=true", "Silk 3", "3.4"},
+		// the in-app browser has no Version token, the OS version is not the browser version
+		{"facebook in-app", "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBDV/iPhone14,5;FBMD/iPhone;FBSN/iOS;FBSV/16.5;FBSS/3;FBID/phone;FBLC/en_US;FBOP/5]", "Safari", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var device = ParseUA(tt.ua)
+			if device.Browser != tt.browser || device.BrowserVersion != tt.version {
+				t.Errorf("got %q %q, want %q %q", device.Browser, device.BrowserVersion, tt.browser, tt.version)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package request
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	netHttp "net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrChecksumMismatch is returned when the downloaded content does not match the checksum
+var ErrChecksumMismatch = errors.New("request: checksum mismatch")
+
+// DownloadOptions struct contains the options for streaming a download
+type DownloadOptions struct {
+	URL     string
+	Headers map[string]string
+	Query   map[string]string
+	// Checksum is verified after the download, eg: "sha256:ab12..." or "md5:ab12..."
+	Checksum string
+	// Progress is called after every chunk with the bytes written so far and
+	// the total size, total is -1 when the server does not send the length
+	Progress func(written, total int64)
+	// Retries is the number of times an interrupted download is resumed with a Range request
+	Retries       int
+	RetryInterval time.Duration
+}
+
+// DownloadResult struct contains the summary of the download
+type DownloadResult struct {
+	Size     int64
+	Checksum string // hex encoded digest of the algorithm used in the checksum option
+	Resumed  int    // number of times the download was resumed
+	Latency  time.Duration
+}
+
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(written, total int64)
+	// dst and digest are rewound when the download has to start again
+	dst    io.Writer
+	digest hash.Hash
+	// validator is sent in If-Range so that a changed file is not resumed
+	validator     string
+	saveValidator func(validator string) error
+}
+
+type truncater interface {
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// reset rewinds the destination to start the download from zero, false is
+// returned when the destination can not be truncated
+func (p *progressWriter) reset() (bool, error) {
+	var t, ok = p.dst.(truncater)
+	if !ok {
+		return false, nil
+	}
+	if err := t.Truncate(0); err != nil {
+		return true, err
+	}
+	if _, err := t.Seek(0, io.SeekStart); err != nil {
+		return true, err
+	}
+	p.digest.Reset()
+	p.written, p.total = 0, -1
+	return true, nil
+}
+
+// setValidator keeps the strong ETag or else the Last-Modified of the response
+func (p *progressWriter) setValidator(header netHttp.Header) error {
+	var validator = header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = header.Get("Last-Modified")
+	}
+	p.validator = validator
+	if p.saveValidator == nil || validator == "" {
+		return nil
+	}
+	return p.saveValidator(validator)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	var n, err = p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil {
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
+
+func newChecksum(checksum string) (hash.Hash, string, error) {
+	if checksum == "" {
+		return sha256.New(), "", nil
+	}
+	var parts = strings.SplitN(checksum, ":", 2)
+	if len(parts) != 2 {
+		return nil, "", fmt.Errorf("request: invalid checksum %q", checksum)
+	}
+	switch strings.ToLower(parts[0]) {
+	case "sha256":
+		return sha256.New(), strings.ToLower(parts[1]), nil
+	case "md5":
+		return md5.New(), strings.ToLower(parts[1]), nil
+	}
+	return nil, "", fmt.Errorf("request: unsupported checksum algorithm %q", parts[0])
+}
+
+// Download method will stream the body of the url to w, the body is never held
+// in memory. Interrupted downloads are resumed from the written offset when the
+// server supports Range requests
+func (c *Client) Download(ctx context.Context, opts *DownloadOptions, w io.Writer) (*DownloadResult, error) {
+	var digest, expected, err = newChecksum(opts.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	var writer = &progressWriter{w: io.MultiWriter(w, digest), total: -1, progress: opts.Progress, dst: w, digest: digest}
+	return c.download(ctx, opts, writer, expected)
+}
+
+// DownloadFile method will download the url to a temp file next to path and
+// rename it into place once the checksum is verified. A partial temp file left
+// by a previous run is resumed when the validator saved next to it still
+// matches, otherwise it is downloaded again
+func (c *Client) DownloadFile(ctx context.Context, opts *DownloadOptions, path string) (*DownloadResult, error) {
+	var digest, expected, err = newChecksum(opts.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	var partial = path + ".part"
+	var sidecar = partial + ".validator"
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var writer = &progressWriter{w: io.MultiWriter(file, digest), total: -1, progress: opts.Progress, dst: file, digest: digest}
+	writer.saveValidator = func(validator string) error {
+		return ioutil.WriteFile(sidecar, []byte(validator), 0644)
+	}
+	validator, err := ioutil.ReadFile(sidecar)
+	if err == nil && len(validator) > 0 {
+		// the existing bytes are hashed so that the checksum covers the whole file
+		writer.validator = string(validator)
+		writer.written, err = io.Copy(digest, file)
+	} else if err == nil || os.IsNotExist(err) {
+		// a partial file without a validator can not be verified
+		_, err = writer.reset()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	result, err := c.download(ctx, opts, writer, expected)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, ErrChecksumMismatch) {
+		os.Remove(partial)
+		os.Remove(sidecar)
+	}
+	if err != nil {
+		return result, err
+	}
+	if err = os.Rename(partial, path); err != nil {
+		return result, err
+	}
+	os.Remove(sidecar)
+	return result, nil
+}
+
+func (c *Client) download(ctx context.Context, opts *DownloadOptions, writer *progressWriter, expected string) (*DownloadResult, error) {
+	var start = time.Now()
+	var result = &DownloadResult{}
+	var interval = opts.RetryInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, interval); err != nil {
+				return result, lastErr
+			}
+			result.Resumed++
+		}
+		var done bool
+		done, lastErr = c.downloadAttempt(ctx, opts, writer)
+		if lastErr == nil || done {
+			break
+		}
+	}
+	result.Size = writer.written
+	result.Latency = time.Since(start)
+	result.Checksum = hex.EncodeToString(writer.digest.Sum(nil))
+	if lastErr != nil {
+		return result, lastErr
+	}
+	if expected != "" && result.Checksum != expected {
+		return result, fmt.Errorf("%w: expected %s got %s", ErrChecksumMismatch, expected, result.Checksum)
+	}
+	return result, nil
+}
+
+// downloadAttempt streams the body from the written offset, done is true when
+// the error can not be fixed by resuming
+func (c *Client) downloadAttempt(ctx context.Context, opts *DownloadOptions, w *progressWriter) (bool, error) {
+	var req, err = netHttp.NewRequestWithContext(ctx, netHttp.MethodGet, buildURL(opts.URL, opts.Query), nil)
+	if err != nil {
+		return true, err
+	}
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.written > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", w.written))
+		if w.validator != "" {
+			req.Header.Set("If-Range", w.validator)
+		}
+	}
+	// the client timeout would cut a long download so only the context bounds
+	// it, the cache is left out since it would hold the whole file in memory
+	var httpClient = *c.backendClient
+	httpClient.Timeout = 0
+	httpClient.Transport = c.chain(false)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() != nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == netHttp.StatusPartialContent && w.written > 0:
+		if resp.ContentLength >= 0 {
+			w.total = w.written + resp.ContentLength
+		}
+	case resp.StatusCode == netHttp.StatusRequestedRangeNotSatisfiable && w.written > 0:
+		// the previous attempt had already written the whole file when the
+		// server reports it as the full length, else the file has changed
+		if resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", w.written) {
+			return true, nil
+		}
+		resp.Body.Close()
+		if ok, err := w.reset(); !ok || err != nil {
+			return true, resetError(err)
+		}
+		return c.downloadAttempt(ctx, opts, w)
+	case resp.StatusCode == netHttp.StatusOK:
+		// the server ignored the range or the validator did not match
+		if w.written > 0 {
+			if ok, err := w.reset(); !ok || err != nil {
+				return true, resetError(err)
+			}
+		}
+		if err = w.setValidator(resp.Header); err != nil {
+			return true, err
+		}
+		w.total = resp.ContentLength
+	default:
+		var body = make([]byte, maxErrorBody)
+		var n, _ = io.ReadFull(resp.Body, body)
+		var httpErr = CheckStatus(&Response{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body[:n]), Header: resp.Header})
+		if httpErr == nil {
+			httpErr = fmt.Errorf("request: unexpected status %s", resp.Status)
+		}
+		return resp.StatusCode < 500, httpErr
+	}
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return ctx.Err() != nil, err
+	}
+	return true, nil
+}
+
+func resetError(err error) error {
+	if err != nil {
+		return err
+	}
+	return errors.New("request: server does not support resuming the download")
+}
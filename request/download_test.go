@@ -0,0 +1,166 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var downloadContent = strings.Repeat("0123456789", 1000)
+
+func downloadChecksum() string {
+	var sum = sha256.Sum256([]byte(downloadContent))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// downloadServer serves the content with Range support, the first response is
+// cut halfway when interrupt is set
+type downloadServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	interrupt bool
+	requests  []*netHttp.Request
+}
+
+func newDownloadServer(t *testing.T, interrupt bool) *downloadServer {
+	var s = &downloadServer{interrupt: interrupt}
+	s.Server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		var cut = s.interrupt
+		s.interrupt = false
+		s.mu.Unlock()
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if cut {
+			w.Header().Set("Content-Length", "10000")
+			w.Write([]byte(downloadContent[:4000]))
+			w.(netHttp.Flusher).Flush()
+			panic(netHttp.ErrAbortHandler)
+		}
+		netHttp.ServeContent(w, r, "", time.Time{}, strings.NewReader(downloadContent))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *downloadServer) header(i int, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[i].Header.Get(name)
+}
+
+func (s *downloadServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func TestDownloadResumes(t *testing.T) {
+	var server = newDownloadServer(t, true)
+	var client = NewClient(&ClientOptions{})
+	var buf bytes.Buffer
+	var result, err = client.Download(context.Background(), &DownloadOptions{URL: server.URL, Checksum: downloadChecksum(), Retries: 2, RetryInterval: time.Millisecond}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != downloadContent || result.Size != int64(len(downloadContent)) || result.Resumed != 1 {
+		t.Errorf("got %d bytes resumed %d times", result.Size, result.Resumed)
+	}
+	if got := server.header(1, "Range"); got != "bytes=4000-" {
+		t.Errorf("resume sent Range %q", got)
+	}
+	if got := server.header(1, "If-Range"); got != `"v1"` {
+		t.Errorf("resume sent If-Range %q", got)
+	}
+}
+
+func TestDownloadBypassesCache(t *testing.T) {
+	var server = newDownloadServer(t, false)
+	var client = NewClient(&ClientOptions{Cache: &CacheOptions{Store: newTestStore()}})
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if _, err := client.Download(context.Background(), &DownloadOptions{URL: server.URL}, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != downloadContent {
+			t.Fatalf("download %d got %d bytes", i, buf.Len())
+		}
+	}
+	if server.count() != 2 {
+		t.Errorf("origin got %d requests, want every download to reach it", server.count())
+	}
+	// the other requests of the client are still cached
+	cacheGet(t, client, server.URL, nil)
+	if resp := cacheGet(t, client, server.URL, nil); cacheState(resp) != "HIT" {
+		t.Errorf("request got %q, want a cache hit", cacheState(resp))
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	var dir = t.TempDir()
+	var path = filepath.Join(dir, "out", "file.txt")
+	var server = newDownloadServer(t, true)
+	var client = NewClient(&ClientOptions{})
+	var opts = &DownloadOptions{URL: server.URL, Checksum: downloadChecksum(), Retries: 1, RetryInterval: time.Millisecond}
+	if _, err := client.DownloadFile(context.Background(), opts, path); err != nil {
+		t.Fatal(err)
+	}
+	var data, _ = ioutil.ReadFile(path)
+	if string(data) != downloadContent {
+		t.Errorf("got %d bytes", len(data))
+	}
+	for _, leftover := range []string{path + ".part", path + ".part.validator"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind", leftover)
+		}
+	}
+}
+
+func TestDownloadFileRestartsChangedFile(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "file.txt")
+	// a previous run of an older version of the file
+	ioutil.WriteFile(path+".part", []byte("stale bytes"), 0644)
+	ioutil.WriteFile(path+".part.validator", []byte(`"v0"`), 0644)
+
+	var server = newDownloadServer(t, false)
+	var client = NewClient(&ClientOptions{})
+	var result, err = client.DownloadFile(context.Background(), &DownloadOptions{URL: server.URL, Checksum: downloadChecksum()}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := server.header(0, "If-Range"); got != `"v0"` {
+		t.Errorf("got If-Range %q", got)
+	}
+	var data, _ = ioutil.ReadFile(path)
+	if string(data) != downloadContent || result.Size != int64(len(downloadContent)) {
+		t.Errorf("got %d bytes, want the file downloaded again", len(data))
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "file.txt")
+	var server = newDownloadServer(t, false)
+	var client = NewClient(&ClientOptions{})
+	var _, err = client.DownloadFile(context.Background(), &DownloadOptions{URL: server.URL, Checksum: "md5:00"}, path)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("got %v, want ErrChecksumMismatch", err)
+	}
+	for _, leftover := range []string{path, path + ".part", path + ".part.validator"} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s exists after the mismatch", leftover)
+		}
+	}
+}
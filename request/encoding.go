@@ -0,0 +1,109 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	netHttp "net/http"
+	"net/url"
+	"unicode/utf8"
+)
+
+const maxErrorBody = 512
+
+// HTTPError struct is returned by the helpers when the response status is not
+// 2xx, the body is capped so that huge error pages do not end up in the logs
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	Header     map[string][]string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("request: unexpected status %s", e.Status)
+	}
+	return fmt.Sprintf("request: unexpected status %s: %s", e.Status, e.Body)
+}
+
+// CheckStatus method will return a HTTPError when the response is not 2xx
+func CheckStatus(resp *Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	var body = resp.Body
+	if len(body) > maxErrorBody {
+		// the cut moves back to the start of a rune so that the body stays valid UTF-8
+		var end = maxErrorBody
+		for end > 0 && !utf8.RuneStart(body[end]) {
+			end--
+		}
+		body = body[:end] + "..."
+	}
+	return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body, Header: resp.Header}
+}
+
+// DecodeJSON method will check the status of the response and decode the JSON
+// body into out, an empty body leaves out untouched
+func DecodeJSON(resp *Response, out interface{}) error {
+	if err := CheckStatus(resp); err != nil {
+		return err
+	}
+	if out == nil || len(resp.Body) == 0 {
+		return nil
+	}
+	return json.Unmarshal([]byte(resp.Body), out)
+}
+
+// withBody returns a copy of the options with the body and content type set so
+// that the options of the caller are not modified. The body of the caller is
+// kept when contentType is empty since no new body was given. The header names
+// are canonicalized so that a "content-type" of the caller is replaced too
+func withBody(opts *RequestOptions, body, contentType string) *RequestOptions {
+	var copied = *opts
+	if contentType != "" {
+		copied.Body = body
+		// the reader of the caller would replace the new body
+		copied.GetBody = nil
+	}
+	copied.Headers = make(map[string]string, len(opts.Headers)+2)
+	for k, v := range opts.Headers {
+		copied.Headers[netHttp.CanonicalHeaderKey(k)] = v
+	}
+	if contentType != "" {
+		copied.Headers["Content-Type"] = contentType
+	}
+	if _, ok := copied.Headers["Accept"]; !ok {
+		copied.Headers["Accept"] = "application/json"
+	}
+	return &copied
+}
+
+// RequestJSON method will send in as JSON body (when not nil) and decode the
+// JSON response into out. Non 2xx responses are returned as *HTTPError
+func (c *Client) RequestJSON(ctx context.Context, opts *RequestOptions, in, out interface{}) (*Response, error) {
+	var body, contentType string
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = string(encoded), "application/json"
+	}
+	resp, err := c.RequestContext(ctx, withBody(opts, body, contentType))
+	if err != nil {
+		return resp, err
+	}
+	return resp, DecodeJSON(resp, out)
+}
+
+// RequestForm method will send the form url encoded and decode the JSON
+// response into out. Non 2xx responses are returned as *HTTPError
+func (c *Client) RequestForm(ctx context.Context, opts *RequestOptions, form url.Values, out interface{}) (*Response, error) {
+	resp, err := c.RequestContext(ctx, withBody(opts, form.Encode(), "application/x-www-form-urlencoded"))
+	if err != nil {
+		return resp, err
+	}
+	return resp, DecodeJSON(resp, out)
+}
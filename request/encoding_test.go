@@ -0,0 +1,57 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRequestJSON(t *testing.T) {
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		var body, _ = ioutil.ReadAll(r.Body)
+		if got := r.Header.Values("Content-Type"); len(got) != 1 || got[0] != "application/json" {
+			w.WriteHeader(netHttp.StatusBadRequest)
+			w.Write([]byte(`{"error":"content type ` + strings.Join(got, ",") + `"}`))
+			return
+		}
+		w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	defer server.Close()
+
+	var client = NewClient(&ClientOptions{})
+	var opts = &RequestOptions{Method: "POST", URL: server.URL, Headers: map[string]string{"content-type": "text/plain"}}
+	var out struct {
+		Echo struct{ Name string } `json:"echo"`
+	}
+	if _, err := client.RequestJSON(context.Background(), opts, map[string]string{"name": "a"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Echo.Name != "a" {
+		t.Errorf("got %+v", out)
+	}
+	if opts.Headers["content-type"] != "text/plain" || len(opts.Headers) != 1 {
+		t.Errorf("headers of the caller were modified: %v", opts.Headers)
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	if err := CheckStatus(&Response{StatusCode: 204}); err != nil {
+		t.Errorf("2xx got %v", err)
+	}
+
+	// a 3 byte rune crosses the cap
+	var body = strings.Repeat("a", maxErrorBody-1) + "€" + "tail"
+	var err = CheckStatus(&Response{StatusCode: 500, Status: "500 Internal Server Error", Body: body})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("got %v, want *HTTPError", err)
+	}
+	if !utf8.ValidString(httpErr.Body) || httpErr.Body != strings.Repeat("a", maxErrorBody-1)+"..." {
+		t.Errorf("got body %q", httpErr.Body)
+	}
+}
@@ -0,0 +1,375 @@
+package request
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	netHttp "net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trustsignalio/golangutils/cache"
+)
+
+const cacheKeyPrefix = "httpcache::"
+const defaultMaxCachedBody = 1 << 20
+
+// credentialHeaders are part of every cache key so that a response is never
+// served to a request with other credentials
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// CacheHeader is set on the responses served from the cache with HIT, STALE or REVALIDATED
+const CacheHeader = "X-Cache"
+
+// ResponseCache interface stores the encoded responses
+type ResponseCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// CacheOptions struct enables the response cache of the client for GET requests
+type CacheOptions struct {
+	Store ResponseCache
+	// DefaultMaxAge is used when the response has validators but no freshness
+	// information, zero means such responses are revalidated on every request
+	DefaultMaxAge time.Duration
+	// StaleIfError serves the stale response for this long when the origin
+	// fails, the stale-if-error directive of the response takes precedence
+	StaleIfError time.Duration
+	// KeyHeaders are request headers which are added to the cache key besides
+	// Authorization and Cookie eg: the api key header of StaticAuthMiddleware
+	KeyHeaders []string
+	// MaxBodySize is the largest body which is cached, defaults to 1MB. The
+	// responses without Content-Length are not cached
+	MaxBodySize int64
+}
+
+type memoryCache struct {
+	client *cache.Client
+}
+
+type multiCache struct {
+	client *cache.MultiClient
+}
+
+type cachedResponse struct {
+	StatusCode   int                 `json:"code"`
+	Status       string              `json:"status"`
+	Header       map[string][]string `json:"header"`
+	Body         []byte              `json:"body"`
+	StoredAt     time.Time           `json:"storedAt"`
+	MaxAge       time.Duration       `json:"maxAge"`
+	StaleIfError time.Duration       `json:"staleIfError"`
+	// Vary holds the request headers the response varies on, the entry under
+	// the url key then only points to the variants keyed by their values
+	Vary []string `json:"vary,omitempty"`
+}
+
+type cacheControl map[string]string
+
+// NewMemoryCache method will return a response cache backed by the in memory cache client
+func NewMemoryCache(c *cache.Client) ResponseCache {
+	return &memoryCache{client: c}
+}
+
+// NewMultiCache method will return a response cache backed by memory and memcache
+func NewMultiCache(c *cache.MultiClient) ResponseCache {
+	return &multiCache{client: c}
+}
+
+func (m *memoryCache) Get(key string) ([]byte, bool) {
+	var value, found = m.client.Get(key)
+	if !found {
+		return nil, false
+	}
+	var data, ok = value.([]byte)
+	return data, ok
+}
+
+func (m *memoryCache) Set(key string, value []byte, ttl time.Duration) {
+	m.client.SetWithExpire(key, value, ttl)
+}
+
+func (m *memoryCache) Delete(key string) {
+	m.client.Delete(key)
+}
+
+func (m *multiCache) Get(key string) ([]byte, bool) {
+	// memcache values are json encoded so the bytes come back as *[]byte
+	var value, found = m.client.GetWithSet(key, new([]byte))
+	if !found {
+		return nil, false
+	}
+	switch data := value.(type) {
+	case []byte:
+		return data, true
+	case *[]byte:
+		return *data, true
+	}
+	return nil, false
+}
+
+func (m *multiCache) Set(key string, value []byte, ttl time.Duration) {
+	var secs = int(ttl / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	m.client.SetWithExpire(key, value, secs)
+}
+
+func (m *multiCache) Delete(key string) {
+	m.client.Delete(key)
+}
+
+func parseCacheControl(header string) cacheControl {
+	var cc = cacheControl{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var kv = strings.SplitN(part, "=", 2)
+		var value string
+		if len(kv) == 2 {
+			value = strings.Trim(kv[1], `"`)
+		}
+		cc[strings.ToLower(kv[0])] = value
+	}
+	return cc
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	var value, ok = cc[directive]
+	if !ok {
+		return 0, false
+	}
+	var secs, err = strconv.Atoi(value)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+func (e *cachedResponse) age() time.Duration {
+	return time.Since(e.StoredAt)
+}
+
+func (e *cachedResponse) fresh() bool {
+	return e.age() < e.MaxAge
+}
+
+func (e *cachedResponse) usableOnError() bool {
+	return e.age() < e.MaxAge+e.StaleIfError
+}
+
+func (e *cachedResponse) response(req *netHttp.Request, state string) *netHttp.Response {
+	var header = netHttp.Header(e.Header).Clone()
+	header.Set("Age", strconv.Itoa(int(e.age()/time.Second)))
+	header.Set(CacheHeader, state)
+	return &netHttp.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// CacheMiddleware method will return a middleware which caches the GET
+// responses honouring Cache-Control max-age and no-store, revalidates the stale
+// responses with If-None-Match and If-Modified-Since and serves the stale
+// response when the origin fails within the stale-if-error window, responses are
+// keyed by the request headers named in Vary
+func CacheMiddleware(opts *CacheOptions) Middleware {
+	return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+		return RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+			var reqCC = parseCacheControl(req.Header.Get("Cache-Control"))
+			if req.Method != netHttp.MethodGet || req.Header.Get("Range") != "" {
+				return next.RoundTrip(req)
+			}
+			if _, noStore := reqCC["no-store"]; noStore {
+				return next.RoundTrip(req)
+			}
+			var baseKey = cacheKey(req, opts.KeyHeaders, nil)
+			var key, entry = baseKey, loadEntry(opts.Store, baseKey)
+			if entry != nil && len(entry.Vary) > 0 {
+				key = cacheKey(req, opts.KeyHeaders, entry.Vary)
+				entry = loadEntry(opts.Store, key)
+			}
+			if _, noCache := reqCC["no-cache"]; entry != nil && entry.fresh() && !noCache {
+				return entry.response(req, "HIT"), nil
+			}
+
+			var outReq = req
+			if entry != nil {
+				outReq = req.Clone(req.Context())
+				if etag := netHttp.Header(entry.Header).Get("ETag"); etag != "" {
+					outReq.Header.Set("If-None-Match", etag)
+				}
+				if lastModified := netHttp.Header(entry.Header).Get("Last-Modified"); lastModified != "" {
+					outReq.Header.Set("If-Modified-Since", lastModified)
+				}
+			}
+			var resp, err = next.RoundTrip(outReq)
+			if entry != nil && (err != nil || resp.StatusCode >= 500) && entry.usableOnError() {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return entry.response(req, "STALE"), nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil && resp.StatusCode == netHttp.StatusNotModified {
+				resp.Body.Close()
+				entry.StoredAt = time.Now()
+				// 304 only carries the headers which changed so merge them first
+				for _, h := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified", "Date"} {
+					if v := resp.Header.Get(h); v != "" {
+						netHttp.Header(entry.Header).Set(h, v)
+					}
+				}
+				freshness(entry, entry.Header, opts)
+				storeEntry(opts.Store, key, entry)
+				return entry.response(req, "REVALIDATED"), nil
+			}
+			return storeResponse(opts, baseKey, req, resp)
+		})
+	}
+}
+
+// cacheKey hashes the url, the credentials and the values of the vary headers
+// of the request so that the key stays within the 250 bytes memcache allows
+func cacheKey(req *netHttp.Request, keyHeaders, vary []string) string {
+	var h = sha256.New()
+	io.WriteString(h, req.URL.String())
+	for _, names := range [][]string{credentialHeaders, keyHeaders, vary} {
+		for _, name := range names {
+			io.WriteString(h, "\n"+name+": "+strings.Join(req.Header.Values(name), ", "))
+		}
+	}
+	return cacheKeyPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// varyHeaders returns the sorted canonical header names of the Vary header,
+// false is returned for Vary: * which can never be matched
+func varyHeaders(header netHttp.Header) ([]string, bool) {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				names = append(names, netHttp.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+// storeResponse saves the cacheable response and returns it with a new body,
+// the bodies of unknown length or larger than MaxBodySize are not read
+func storeResponse(opts *CacheOptions, baseKey string, req *netHttp.Request, resp *netHttp.Response) (*netHttp.Response, error) {
+	var cc = parseCacheControl(resp.Header.Get("Cache-Control"))
+	if _, noStore := cc["no-store"]; noStore || resp.StatusCode != netHttp.StatusOK {
+		return resp, nil
+	}
+	var maxBody = opts.MaxBodySize
+	if maxBody <= 0 {
+		maxBody = defaultMaxCachedBody
+	}
+	if resp.ContentLength < 0 || resp.ContentLength > maxBody {
+		return resp, nil
+	}
+	var vary, ok = varyHeaders(resp.Header)
+	if !ok {
+		return resp, nil
+	}
+	var entry = &cachedResponse{StatusCode: resp.StatusCode, Status: resp.Status, Header: resp.Header.Clone(), StoredAt: time.Now(), Vary: vary}
+	if !freshness(entry, resp.Header, opts) {
+		return resp, nil
+	}
+	var body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	entry.Body = body
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if len(vary) == 0 {
+		storeEntry(opts.Store, baseKey, entry)
+		return resp, nil
+	}
+	storeEntry(opts.Store, cacheKey(req, opts.KeyHeaders, vary), entry)
+	storeEntry(opts.Store, baseKey, &cachedResponse{Header: entry.Header, StoredAt: entry.StoredAt, MaxAge: entry.MaxAge, StaleIfError: entry.StaleIfError, Vary: vary})
+	return resp, nil
+}
+
+// freshness sets the max age and stale-if-error of the entry from the response
+// headers, false is returned when the response must not be cached
+func freshness(entry *cachedResponse, header netHttp.Header, opts *CacheOptions) bool {
+	var cc = parseCacheControl(header.Get("Cache-Control"))
+	entry.StaleIfError = opts.StaleIfError
+	if staleIfError, ok := cc.seconds("stale-if-error"); ok {
+		entry.StaleIfError = staleIfError
+	}
+	var hasValidator = header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+	if _, noCache := cc["no-cache"]; noCache {
+		entry.MaxAge = 0
+		return hasValidator
+	}
+	if maxAge, ok := cc.seconds("max-age"); ok {
+		entry.MaxAge = maxAge
+		return maxAge > 0 || hasValidator
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if t, err := netHttp.ParseTime(expires); err == nil {
+			entry.MaxAge = time.Until(t)
+			if entry.MaxAge < 0 {
+				entry.MaxAge = 0
+			}
+			return entry.MaxAge > 0 || hasValidator
+		}
+	}
+	entry.MaxAge = opts.DefaultMaxAge
+	return hasValidator
+}
+
+func loadEntry(store ResponseCache, key string) *cachedResponse {
+	var data, found = store.Get(key)
+	if !found {
+		return nil
+	}
+	var entry = &cachedResponse{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil
+	}
+	return entry
+}
+
+// storeEntry keeps the validators around for a day after the entry is stale so
+// that it can be revalidated instead of fetched again
+func storeEntry(store ResponseCache, key string, entry *cachedResponse) {
+	var data, err = json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	var ttl = entry.MaxAge + entry.StaleIfError
+	if netHttp.Header(entry.Header).Get("ETag") != "" || netHttp.Header(entry.Header).Get("Last-Modified") != "" {
+		ttl += 24 * time.Hour
+	}
+	store.Set(key, data, ttl)
+}
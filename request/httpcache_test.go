@@ -0,0 +1,195 @@
+package request
+
+import (
+	"context"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/trustsignalio/golangutils/cache"
+)
+
+type staticTokenSource string
+
+func (s staticTokenSource) Token(ctx context.Context) (*Token, error) {
+	return &Token{AccessToken: string(s)}, nil
+}
+
+// cacheServer counts the requests which reach the origin
+type cacheServer struct {
+	*httptest.Server
+	hits int32
+}
+
+func newCacheServer(t *testing.T, handler func(w netHttp.ResponseWriter, r *netHttp.Request)) *cacheServer {
+	var s = &cacheServer{}
+	s.Server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		atomic.AddInt32(&s.hits, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *cacheServer) count() int {
+	return int(atomic.LoadInt32(&s.hits))
+}
+
+func cacheGet(t *testing.T, client *Client, url string, headers map[string]string) *Response {
+	t.Helper()
+	var resp, err = client.Request(&RequestOptions{URL: url, Headers: headers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func cacheState(resp *Response) string {
+	return netHttp.Header(resp.Header).Get(CacheHeader)
+}
+
+func newTestStore() ResponseCache {
+	return NewMemoryCache(cache.NewClient("test", 1))
+}
+
+func TestCacheSeparatesCredentials(t *testing.T) {
+	var server = newCacheServer(t, func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	})
+	var store = newTestStore()
+	var oauthClient = NewClient(&ClientOptions{Cache: &CacheOptions{Store: store}, TokenSource: staticTokenSource("a")})
+	var bearerClient = NewClient(&ClientOptions{Cache: &CacheOptions{Store: store}, Middlewares: []Middleware{BearerAuthMiddleware("b")}})
+
+	if resp := cacheGet(t, oauthClient, server.URL, nil); resp.Body != "Bearer a" {
+		t.Fatalf("first client got %q", resp.Body)
+	}
+	if resp := cacheGet(t, bearerClient, server.URL, nil); resp.Body != "Bearer b" {
+		t.Errorf("second client got %q, the response of the other credential", resp.Body)
+	}
+	if resp := cacheGet(t, oauthClient, server.URL, nil); resp.Body != "Bearer a" || cacheState(resp) != "HIT" {
+		t.Errorf("first client again got %q %q, want a cache hit", resp.Body, cacheState(resp))
+	}
+	if server.count() != 2 {
+		t.Errorf("origin got %d requests, want 2", server.count())
+	}
+}
+
+func TestCacheKeyHeaders(t *testing.T) {
+	var server = newCacheServer(t, func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("X-Api-Key")))
+	})
+	var store = newTestStore()
+	var opts = &CacheOptions{Store: store, KeyHeaders: []string{"X-Api-Key"}}
+	var first = NewClient(&ClientOptions{Cache: opts, Middlewares: []Middleware{StaticAuthMiddleware("X-Api-Key", "one")}})
+	var second = NewClient(&ClientOptions{Cache: opts, Middlewares: []Middleware{StaticAuthMiddleware("X-Api-Key", "two")}})
+	cacheGet(t, first, server.URL, nil)
+	if resp := cacheGet(t, second, server.URL, nil); resp.Body != "two" {
+		t.Errorf("got %q, want the response of the second key", resp.Body)
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	var server = newCacheServer(t, func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(netHttp.StatusNotModified)
+			return
+		}
+		w.Write([]byte("body"))
+	})
+	var client = NewClient(&ClientOptions{Cache: &CacheOptions{Store: newTestStore()}})
+	cacheGet(t, client, server.URL, nil)
+	var resp = cacheGet(t, client, server.URL, nil)
+	if resp.Body != "body" || resp.StatusCode != 200 || cacheState(resp) != "REVALIDATED" {
+		t.Errorf("got %d %q %q, want the revalidated body", resp.StatusCode, resp.Body, cacheState(resp))
+	}
+	if server.count() != 2 {
+		t.Errorf("origin got %d requests, want 2", server.count())
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	var failing int32
+	var server = newCacheServer(t, func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(netHttp.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("body"))
+	})
+	var client = NewClient(&ClientOptions{Cache: &CacheOptions{Store: newTestStore()}})
+	cacheGet(t, client, server.URL, nil)
+	atomic.StoreInt32(&failing, 1)
+	if resp := cacheGet(t, client, server.URL, nil); resp.Body != "body" || cacheState(resp) != "STALE" {
+		t.Errorf("got %d %q %q, want the stale body", resp.StatusCode, resp.Body, cacheState(resp))
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	var server = newCacheServer(t, func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	})
+	var client = NewClient(&ClientOptions{Cache: &CacheOptions{Store: newTestStore()}})
+	for _, lang := range []string{"en", "fr", "en", "fr"} {
+		if resp := cacheGet(t, client, server.URL, map[string]string{"Accept-Language": lang}); resp.Body != lang {
+			t.Errorf("%s got %q", lang, resp.Body)
+		}
+	}
+	if server.count() != 2 {
+		t.Errorf("origin got %d requests, want 2", server.count())
+	}
+}
+
+func TestCacheSkipsLargeAndUnknownBodies(t *testing.T) {
+	var server = newCacheServer(t, func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Path == "/chunked" {
+			w.Write([]byte("small"))
+			// flushing before the handler returns drops the Content-Length
+			w.(netHttp.Flusher).Flush()
+			return
+		}
+		w.Write([]byte(strings.Repeat("x", 64)))
+	})
+	var client = NewClient(&ClientOptions{Cache: &CacheOptions{Store: newTestStore(), MaxBodySize: 32}})
+	for _, path := range []string{"/large", "/large", "/chunked", "/chunked"} {
+		if resp := cacheGet(t, client, server.URL+path, nil); cacheState(resp) != "" {
+			t.Errorf("%s got %q, want the response not cached", path, cacheState(resp))
+		}
+	}
+	if server.count() != 4 {
+		t.Errorf("origin got %d requests, want 4", server.count())
+	}
+}
+
+func TestCacheStoreResponseKeepsBody(t *testing.T) {
+	var opts = &CacheOptions{Store: newTestStore()}
+	var req = httptest.NewRequest("GET", "http://example.com/", nil)
+	var resp = &netHttp.Response{
+		StatusCode:    200,
+		Header:        netHttp.Header{"Cache-Control": {"max-age=60"}},
+		Body:          ioutil.NopCloser(strings.NewReader("body")),
+		ContentLength: 4,
+	}
+	var got, err = storeResponse(opts, cacheKey(req, nil, nil), req, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body, _ = ioutil.ReadAll(got.Body)
+	if string(body) != "body" {
+		t.Errorf("got body %q", body)
+	}
+	if entry := loadEntry(opts.Store, cacheKey(req, nil, nil)); entry == nil || string(entry.Body) != "body" {
+		t.Errorf("got entry %+v", entry)
+	}
+}
@@ -0,0 +1,140 @@
+package request
+
+import (
+	"log"
+	netHttp "net/http"
+	"time"
+)
+
+// Middleware wraps the round tripper of the client, it can modify the request
+// before calling next and inspect the response returned by it. Middlewares
+// must not modify the request they receive, they should clone it first
+type Middleware func(next netHttp.RoundTripper) netHttp.RoundTripper
+
+// RoundTripperFunc is an adapter to use a func as http.RoundTripper
+type RoundTripperFunc func(req *netHttp.Request) (*netHttp.Response, error)
+
+// RoundTrip calls f(req)
+func (f RoundTripperFunc) RoundTrip(req *netHttp.Request) (*netHttp.Response, error) {
+	return f(req)
+}
+
+// Metric struct contains the information of a single round trip
+type Metric struct {
+	Method     string
+	Host       string
+	Path       string
+	StatusCode int
+	Error      error
+	Latency    time.Duration
+}
+
+// Chain method will wrap the base round tripper with the middlewares, the
+// first middleware is the outermost and sees the request first
+func Chain(base netHttp.RoundTripper, middlewares ...Middleware) netHttp.RoundTripper {
+	if base == nil {
+		base = netHttp.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		base = middlewares[i](base)
+	}
+	return base
+}
+
+// Use method will append the middlewares to the chain of the client, it
+// should be called before the client is shared between goroutines. The
+// response cache stays innermost so that it sees the credentials set by the
+// middlewares
+func (c *Client) Use(middlewares ...Middleware) {
+	c.middlewares = append(c.middlewares, middlewares...)
+	c.backendClient.Transport = c.chain(true)
+}
+
+// chain returns the base transport wrapped with the middlewares, the cache is
+// left out for the downloads since it buffers the whole body
+func (c *Client) chain(withCache bool) netHttp.RoundTripper {
+	var middlewares = c.middlewares
+	if withCache && c.cache != nil {
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], c.cache)
+	}
+	return Chain(c.baseTransport, middlewares...)
+}
+
+// HeaderMiddleware method will set the headers on every request, the headers
+// already present on the request are not overwritten
+func HeaderMiddleware(headers map[string]string) Middleware {
+	return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+		return RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+			req = req.Clone(req.Context())
+			for k, v := range headers {
+				if req.Header.Get(k) == "" {
+					req.Header.Set(k, v)
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// StaticAuthMiddleware method will set the auth header with a fixed value eg: an api key
+func StaticAuthMiddleware(header, value string) Middleware {
+	return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+		return RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set(header, value)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// BearerAuthMiddleware method will set the Authorization header with the bearer token
+func BearerAuthMiddleware(token string) Middleware {
+	return StaticAuthMiddleware("Authorization", "Bearer "+token)
+}
+
+// RequestIDMiddleware method will set the header with the id generated by
+// newID when the request does not have one already
+func RequestIDMiddleware(header string, newID func() string) Middleware {
+	return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+		return RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+			if req.Header.Get(header) == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set(header, newID())
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// MetricsMiddleware method will call observe with the latency and status of
+// every round trip, retries are observed separately
+func MetricsMiddleware(observe func(Metric)) Middleware {
+	return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+		return RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+			var start = time.Now()
+			var resp, err = next.RoundTrip(req)
+			var m = Metric{Method: req.Method, Host: req.URL.Host, Path: req.URL.Path, Error: err, Latency: time.Since(start)}
+			if resp != nil {
+				m.StatusCode = resp.StatusCode
+			}
+			observe(m)
+			return resp, err
+		})
+	}
+}
+
+// LoggingMiddleware method will log every round trip with the given logger,
+// the standard logger is used when logger is nil. The query is not logged
+// since it often contains the credentials
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.New(log.Writer(), "", log.LstdFlags)
+	}
+	return MetricsMiddleware(func(m Metric) {
+		if m.Error != nil {
+			logger.Printf("request: %s %s%s failed after %s: %v", m.Method, m.Host, m.Path, m.Latency, m.Error)
+			return
+		}
+		logger.Printf("request: %s %s%s %d %s", m.Method, m.Host, m.Path, m.StatusCode, m.Latency)
+	})
+}
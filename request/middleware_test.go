@@ -0,0 +1,119 @@
+package request
+
+import (
+	"bytes"
+	"log"
+	netHttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// echoServer responds with the request headers so that the tests can check
+// what reached the server
+func echoServer(t *testing.T) *httptest.Server {
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		for k, v := range r.Header {
+			w.Header()["Echo-"+k] = v
+		}
+		w.WriteHeader(netHttp.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	var trace = func(name string) Middleware {
+		return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+			return RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+				order = append(order, name+" in")
+				var resp, err = next.RoundTrip(req)
+				order = append(order, name+" out")
+				return resp, err
+			})
+		}
+	}
+	var server = echoServer(t)
+	var client = NewClient(&ClientOptions{Middlewares: []Middleware{trace("a"), trace("b")}})
+	client.Use(trace("c"))
+	if _, err := client.Request(&RequestOptions{URL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	var want = []string{"a in", "b in", "c in", "c out", "b out", "a out"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+}
+
+func TestHeaderMiddlewares(t *testing.T) {
+	var server = echoServer(t)
+	var ids int
+	var client = NewClient(&ClientOptions{Middlewares: []Middleware{
+		HeaderMiddleware(map[string]string{"X-Team": "ads", "User-Agent": "golangutils"}),
+		StaticAuthMiddleware("X-Api-Key", "secret"),
+		RequestIDMiddleware("X-Request-Id", func() string { ids++; return "generated" }),
+	}})
+
+	var opts = &RequestOptions{URL: server.URL, Headers: map[string]string{"X-Team": "mine", "X-Api-Key": "caller", "X-Request-Id": "given"}}
+	var resp, err = client.Request(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct{ header, want string }{
+		{"X-Team", "mine"},            // present headers are kept
+		{"User-Agent", "golangutils"}, // missing headers are set
+		{"X-Api-Key", "secret"},       // the auth header always wins
+		{"X-Request-Id", "given"},     // the id of the caller is kept
+	}
+	for _, tt := range tests {
+		if got := netHttp.Header(resp.Header).Get("Echo-" + tt.header); got != tt.want {
+			t.Errorf("%s got %q, want %q", tt.header, got, tt.want)
+		}
+	}
+	if ids != 0 {
+		t.Errorf("generated %d ids, want none", ids)
+	}
+
+	resp, err = client.Request(&RequestOptions{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := netHttp.Header(resp.Header).Get("Echo-X-Request-Id"); got != "generated" {
+		t.Errorf("request id got %q, want generated", got)
+	}
+}
+
+func TestMiddlewaresCloneTheRequest(t *testing.T) {
+	var base = RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+		return &netHttp.Response{StatusCode: 200, Body: netHttp.NoBody, Request: req}, nil
+	})
+	var rt = Chain(base, HeaderMiddleware(map[string]string{"A": "1"}), BearerAuthMiddleware("token"), RequestIDMiddleware("X-Id", func() string { return "1" }))
+	var req = httptest.NewRequest("GET", "http://example.com/", nil)
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Header) != 0 {
+		t.Errorf("the request of the caller was modified: %v", req.Header)
+	}
+}
+
+func TestMetricsAndLoggingMiddleware(t *testing.T) {
+	var server = echoServer(t)
+	var metrics []Metric
+	var logs bytes.Buffer
+	var client = NewClient(&ClientOptions{Middlewares: []Middleware{
+		MetricsMiddleware(func(m Metric) { metrics = append(metrics, m) }),
+		LoggingMiddleware(log.New(&logs, "", 0)),
+	}})
+	if _, err := client.Request(&RequestOptions{URL: server.URL + "/path", Query: map[string]string{"key": "secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 || metrics[0].Path != "/path" || metrics[0].StatusCode != 200 || metrics[0].Method != "GET" {
+		t.Errorf("got metrics %+v", metrics)
+	}
+	if !strings.Contains(logs.String(), "/path 200") || strings.Contains(logs.String(), "secret") {
+		t.Errorf("got log %q", logs.String())
+	}
+}
@@ -0,0 +1,180 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	netHttp "net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrBodyConsumed is returned when a multipart body with a part that can not be
+// reopened is sent again eg: by a retry
+var ErrBodyConsumed = errors.New("request: multipart body can not be reopened")
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// Multipart builds a multipart/form-data body which is streamed to the server,
+// the files are read while the request is sent and never held in memory
+type Multipart struct {
+	boundary string
+	parts    []multipartPart
+	mu       sync.Mutex
+	opened   bool
+}
+
+type multipartPart struct {
+	name        string
+	filename    string
+	contentType string
+	value       string
+	open        func() (io.ReadCloser, error)
+	reopenable  bool
+}
+
+// NewMultipart method will return an empty multipart body with a random boundary
+func NewMultipart() *Multipart {
+	return &Multipart{boundary: multipart.NewWriter(nil).Boundary()}
+}
+
+// AddField method will add a text field
+func (m *Multipart) AddField(name, value string) *Multipart {
+	m.parts = append(m.parts, multipartPart{name: name, value: value, reopenable: true})
+	return m
+}
+
+// AddFile method will add a file part read from r, the reader can be read
+// only once so the request will not be retried after the body is sent. The
+// reader is closed after it is read when it implements io.Closer
+func (m *Multipart) AddFile(name, filename, contentType string, r io.Reader) *Multipart {
+	var open = func() (io.ReadCloser, error) {
+		if rc, ok := r.(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return ioutil.NopCloser(r), nil
+	}
+	m.parts = append(m.parts, multipartPart{name: name, filename: filename, contentType: contentType, open: open})
+	return m
+}
+
+// AddFileFunc method will add a file part which is opened for every attempt so
+// that the request can be retried
+func (m *Multipart) AddFileFunc(name, filename, contentType string, open func() (io.ReadCloser, error)) *Multipart {
+	m.parts = append(m.parts, multipartPart{name: name, filename: filename, contentType: contentType, open: open, reopenable: true})
+	return m
+}
+
+// AddFilePath method will add the file at path, the filename is the base name of the path
+func (m *Multipart) AddFilePath(name, path, contentType string) *Multipart {
+	return m.AddFileFunc(name, filepath.Base(path), contentType, func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+}
+
+// ContentType method will return the Content-Type header with the boundary
+func (m *Multipart) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// Reopenable method will return true when every part can be read again
+func (m *Multipart) Reopenable() bool {
+	for _, p := range m.parts {
+		if !p.reopenable {
+			return false
+		}
+	}
+	return true
+}
+
+// Open method will return a new reader of the body, the body is written by a
+// goroutine which stops when the reader is closed
+func (m *Multipart) Open() (io.ReadCloser, error) {
+	m.mu.Lock()
+	if m.opened && !m.Reopenable() {
+		m.mu.Unlock()
+		return nil, ErrBodyConsumed
+	}
+	m.opened = true
+	m.mu.Unlock()
+
+	var pr, pw = io.Pipe()
+	go func() {
+		pw.CloseWithError(m.write(pw))
+	}()
+	return pr, nil
+}
+
+func (m *Multipart) write(w io.Writer) error {
+	var mw = multipart.NewWriter(w)
+	if err := mw.SetBoundary(m.boundary); err != nil {
+		return err
+	}
+	for _, p := range m.parts {
+		if p.open == nil {
+			if err := mw.WriteField(p.name, p.value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeFilePart(mw, p); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func writeFilePart(mw *multipart.Writer, p multipartPart) error {
+	var contentType = p.contentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	var header = make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(p.name), quoteEscaper.Replace(p.filename)))
+	header.Set("Content-Type", contentType)
+	var pw, err = mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	rc, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(pw, rc)
+	return err
+}
+
+// RequestMultipart method will send the multipart body with the options, the
+// retries of the options are used only when every part can be reopened
+func (c *Client) RequestMultipart(ctx context.Context, opts *RequestOptions, body *Multipart) (*Response, error) {
+	var copied = withBody(opts, "", body.ContentType())
+	if !hasHeader(opts.Headers, "Accept") {
+		delete(copied.Headers, "Accept")
+	}
+	if copied.Method == "" {
+		copied.Method = "POST"
+	}
+	copied.GetBody = body.Open
+	if !body.Reopenable() {
+		copied.Retries = 1
+	}
+	return c.RequestContext(ctx, copied)
+}
+
+// hasHeader reports if the header is set in any case of the name
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if netHttp.CanonicalHeaderKey(k) == name {
+			return true
+		}
+	}
+	return false
+}
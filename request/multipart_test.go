@@ -0,0 +1,145 @@
+package request
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	netHttp "net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedReader returns its content only after the gate is closed
+type gatedReader struct {
+	gate    chan struct{}
+	content io.Reader
+}
+
+func (g *gatedReader) Read(p []byte) (int, error) {
+	<-g.gate
+	return g.content.Read(p)
+}
+
+func TestMultipartBody(t *testing.T) {
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		if r.Header.Get("Accept") != "text/plain" {
+			netHttp.Error(w, "accept of the caller was dropped", netHttp.StatusBadRequest)
+			return
+		}
+		var _, params, err = mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || params["boundary"] == "" {
+			netHttp.Error(w, "missing boundary", netHttp.StatusBadRequest)
+			return
+		}
+		reader, err := r.MultipartReader()
+		if err != nil {
+			netHttp.Error(w, err.Error(), netHttp.StatusBadRequest)
+			return
+		}
+		for {
+			var part, err = reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				netHttp.Error(w, err.Error(), netHttp.StatusBadRequest)
+				return
+			}
+			var data, _ = ioutil.ReadAll(part)
+			io.WriteString(w, part.FormName()+"|"+part.FileName()+"|"+part.Header.Get("Content-Type")+"|"+string(data)+"\n")
+		}
+	}))
+	defer server.Close()
+
+	var path = filepath.Join(t.TempDir(), "report.csv")
+	ioutil.WriteFile(path, []byte("a,b\n"), 0644)
+	var body = NewMultipart().
+		AddField("site", "example").
+		AddFile("upload", `we"ird.txt`, "text/plain", strings.NewReader("hello")).
+		AddFilePath("report", path, "")
+
+	var client = NewClient(&ClientOptions{})
+	var resp, err = client.RequestMultipart(context.Background(), &RequestOptions{URL: server.URL, Headers: map[string]string{"accept": "text/plain"}}, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want = "site|||example\n" +
+		`upload|we"ird.txt|text/plain|hello` + "\n" +
+		"report|report.csv|application/octet-stream|a,b\n\n"
+	if resp.StatusCode != 200 || resp.Body != want {
+		t.Errorf("got %d %q, want %q", resp.StatusCode, resp.Body, want)
+	}
+}
+
+func TestMultipartStreams(t *testing.T) {
+	// the file is only readable after the server has read the field before
+	// it, a body built in memory would never reach the server
+	var gate = make(chan struct{})
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		var reader, _ = r.MultipartReader()
+		var part, err = reader.NextPart()
+		if err != nil || part.FormName() != "first" {
+			netHttp.Error(w, "missing first part", netHttp.StatusBadRequest)
+			return
+		}
+		close(gate)
+		part, err = reader.NextPart()
+		if err != nil {
+			netHttp.Error(w, err.Error(), netHttp.StatusBadRequest)
+			return
+		}
+		var data, _ = ioutil.ReadAll(part)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	var body = NewMultipart().AddField("first", "1").AddFile("file", "f", "", &gatedReader{gate: gate, content: strings.NewReader("streamed")})
+	var client = NewClient(&ClientOptions{Timeout: 5})
+	var resp, err = client.RequestMultipart(context.Background(), &RequestOptions{URL: server.URL}, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "streamed" {
+		t.Errorf("got %q", resp.Body)
+	}
+}
+
+func TestMultipartRetries(t *testing.T) {
+	var attempts int32
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		var data, _ = ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(netHttp.StatusServiceUnavailable)
+			return
+		}
+		if !strings.Contains(string(data), "content") {
+			w.WriteHeader(netHttp.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	var client = NewClient(&ClientOptions{})
+	var opts = &RequestOptions{URL: server.URL, Retries: 3, RetryInterval: time.Millisecond, RetryPolicy: DefaultRetryPolicy()}
+
+	var reopenable = NewMultipart().AddFileFunc("file", "f", "", func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("content")), nil
+	})
+	var resp, err = client.RequestMultipart(context.Background(), opts, reopenable)
+	if err != nil || resp.StatusCode != 200 || attempts != 2 {
+		t.Errorf("reopenable got %v %v after %d attempts, want 200 after 2", resp, err, attempts)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	var once = NewMultipart().AddFile("file", "f", "", strings.NewReader("content"))
+	resp, err = client.RequestMultipart(context.Background(), opts, once)
+	if err != nil || resp.StatusCode != 503 || attempts != 1 {
+		t.Errorf("single use reader got %v %v after %d attempts, want 503 after 1", resp, err, attempts)
+	}
+	if _, err := once.Open(); err != ErrBodyConsumed {
+		t.Errorf("reopen got %v, want ErrBodyConsumed", err)
+	}
+}
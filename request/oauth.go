@@ -0,0 +1,240 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	netHttp "net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRefreshAhead = time.Minute
+const tokenFetchTimeout = 30 * time.Second
+
+// Token struct contains the OAuth2 access token
+type Token struct {
+	AccessToken string
+	TokenType   string
+	Expiry      time.Time // zero means the token does not expire
+}
+
+// TokenSource returns a token for the requests, the implementations must be
+// safe for concurrent use
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// ClientCredentialsOptions struct contains the options of the OAuth2 client credentials flow
+type ClientCredentialsOptions struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	Params       map[string]string // extra form params eg: audience
+	// AuthInParams sends the credentials in the form instead of basic auth
+	AuthInParams bool
+}
+
+// CachedTokenSource caches the token of the source and refreshes it before it
+// expires, concurrent callers share a single refresh
+type CachedTokenSource struct {
+	src      TokenSource
+	ahead    time.Duration
+	mu       sync.Mutex
+	token    *Token
+	inflight chan struct{}
+	err      error
+}
+
+type clientCredentials struct {
+	opts   ClientCredentialsOptions
+	client *Client
+}
+
+type tokenResponse struct {
+	AccessToken string  `json:"access_token"`
+	TokenType   string  `json:"token_type"`
+	ExpiresIn   flexInt `json:"expires_in"`
+}
+
+// flexInt accepts expires_in sent as number or string by some providers
+type flexInt int64
+
+func (n *flexInt) UnmarshalJSON(data []byte) error {
+	var s = strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	var v int64
+	if _, err := fmt.Sscan(s, &v); err != nil {
+		return fmt.Errorf("request: invalid expires_in %s", data)
+	}
+	*n = flexInt(v)
+	return nil
+}
+
+func (t *Token) expired(ahead time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return true
+	}
+	return !t.Expiry.IsZero() && time.Now().Add(ahead).After(t.Expiry)
+}
+
+// authorization returns the value of the Authorization header
+func (t *Token) authorization() string {
+	var tokenType = t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// NewClientCredentials method will return a token source which fetches the
+// tokens with the client credentials grant, client is used for the token
+// requests and must not use the OAuth middleware, nil creates a new client.
+// The source is not cached, wrap it with NewCachedTokenSource
+func NewClientCredentials(opts *ClientCredentialsOptions, client *Client) TokenSource {
+	if client == nil {
+		client = NewClient(&ClientOptions{Timeout: int(tokenFetchTimeout / time.Second)})
+	}
+	return &clientCredentials{opts: *opts, client: client}
+}
+
+func (cc *clientCredentials) Token(ctx context.Context) (*Token, error) {
+	var form = url.Values{"grant_type": {"client_credentials"}}
+	if len(cc.opts.Scopes) > 0 {
+		form.Set("scope", strings.Join(cc.opts.Scopes, " "))
+	}
+	for k, v := range cc.opts.Params {
+		form.Set(k, v)
+	}
+	var headers = map[string]string{}
+	if cc.opts.AuthInParams {
+		form.Set("client_id", cc.opts.ClientID)
+		form.Set("client_secret", cc.opts.ClientSecret)
+	} else {
+		var req = &netHttp.Request{Header: netHttp.Header{}}
+		req.SetBasicAuth(url.QueryEscape(cc.opts.ClientID), url.QueryEscape(cc.opts.ClientSecret))
+		headers["Authorization"] = req.Header.Get("Authorization")
+	}
+	var resp tokenResponse
+	if _, err := cc.client.RequestForm(ctx, &RequestOptions{Method: "POST", URL: cc.opts.TokenURL, Headers: headers}, form, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, errors.New("request: token response has no access_token")
+	}
+	var token = &Token{AccessToken: resp.AccessToken, TokenType: resp.TokenType}
+	if resp.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// NewCachedTokenSource method will cache the tokens of src and refresh them
+// ahead of the expiry, zero ahead uses one minute
+func NewCachedTokenSource(src TokenSource, ahead time.Duration) *CachedTokenSource {
+	if ahead == 0 {
+		ahead = defaultRefreshAhead
+	}
+	return &CachedTokenSource{src: src, ahead: ahead}
+}
+
+// Token method will return the cached token, a token which is about to expire
+// is still returned while it is refreshed in the background
+func (s *CachedTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	var current = s.token
+	if !current.expired(s.ahead) {
+		s.mu.Unlock()
+		return current, nil
+	}
+	if s.inflight == nil {
+		s.inflight = make(chan struct{})
+		go s.refresh(s.inflight)
+	}
+	var done = s.inflight
+	s.mu.Unlock()
+
+	if !current.expired(0) {
+		return current, nil
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.token, nil
+}
+
+// refresh is not bound to the context of a caller since the result is shared
+func (s *CachedTokenSource) refresh(done chan struct{}) {
+	var ctx, cancel = context.WithTimeout(context.Background(), tokenFetchTimeout)
+	defer cancel()
+	var token, err = s.src.Token(ctx)
+	s.mu.Lock()
+	if err == nil {
+		s.token = token
+	}
+	s.err = err
+	s.inflight = nil
+	s.mu.Unlock()
+	close(done)
+}
+
+// Invalidate method will drop the token so that the next call fetches a new
+// one, it is a no-op when the cached token was already replaced
+func (s *CachedTokenSource) Invalidate(token *Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && token != nil && s.token.AccessToken == token.AccessToken {
+		s.token = nil
+	}
+}
+
+// OAuthMiddleware method will set the Authorization header with the token of
+// src. When the response is 401 the token is invalidated and the request is
+// retried once with a fresh token, provided the body can be sent again
+func OAuthMiddleware(src *CachedTokenSource) Middleware {
+	return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+		return RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+			var token, err = src.Token(req.Context())
+			if err != nil {
+				return nil, err
+			}
+			var authReq = req.Clone(req.Context())
+			authReq.Header.Set("Authorization", token.authorization())
+			resp, err := next.RoundTrip(authReq)
+			if err != nil || resp.StatusCode != netHttp.StatusUnauthorized {
+				return resp, err
+			}
+			var canRetry = req.Body == nil || req.Body == netHttp.NoBody || req.GetBody != nil
+			if !canRetry {
+				return resp, nil
+			}
+			src.Invalidate(token)
+			fresh, err := src.Token(req.Context())
+			if err != nil || fresh.AccessToken == token.AccessToken {
+				// the 401 is not caused by the token, return it as it is
+				return resp, nil
+			}
+			resp.Body.Close()
+			var retry = req.Clone(req.Context())
+			if req.GetBody != nil {
+				if retry.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+			retry.Header.Set("Authorization", fresh.authorization())
+			return next.RoundTrip(retry)
+		})
+	}
+}
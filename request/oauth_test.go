@@ -0,0 +1,188 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTokenSource returns t1, t2... and blocks every fetch on the gate when it is set
+type countingTokenSource struct {
+	calls  int32
+	expiry time.Duration
+	gate   chan struct{}
+}
+
+func (s *countingTokenSource) Token(ctx context.Context) (*Token, error) {
+	if s.gate != nil {
+		<-s.gate
+	}
+	var n = atomic.AddInt32(&s.calls, 1)
+	var token = &Token{AccessToken: fmt.Sprintf("t%d", n)}
+	if s.expiry != 0 {
+		token.Expiry = time.Now().Add(s.expiry)
+	}
+	return token, nil
+}
+
+func TestOAuthRefreshesOnUnauthorized(t *testing.T) {
+	// the api revokes t1 after the first request
+	var valid atomic.Value
+	valid.Store("Bearer t1")
+	var bodies []string
+	var mu sync.Mutex
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		var body, _ = ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		if r.Header.Get("Authorization") != valid.Load().(string) {
+			w.WriteHeader(netHttp.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	var src = &countingTokenSource{}
+	var client = NewClient(&ClientOptions{TokenSource: src})
+	if resp, err := client.Request(&RequestOptions{URL: server.URL}); err != nil || resp.Body != "Bearer t1" {
+		t.Fatalf("first request got %v %v", resp, err)
+	}
+	valid.Store("Bearer t2")
+	var resp, err = client.Request(&RequestOptions{Method: "POST", URL: server.URL, Body: "payload"})
+	if err != nil || resp.StatusCode != 200 || resp.Body != "Bearer t2" {
+		t.Fatalf("after the revocation got %v %v, want the retry with t2", resp, err)
+	}
+	if got := atomic.LoadInt32(&src.calls); got != 2 {
+		t.Errorf("fetched %d tokens, want 2", got)
+	}
+	if bodies[len(bodies)-1] != "payload" {
+		t.Errorf("the retry sent body %q", bodies[len(bodies)-1])
+	}
+}
+
+func TestOAuthRetriesOnlyOnce(t *testing.T) {
+	var hits int32
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(netHttp.StatusUnauthorized)
+	}))
+	defer server.Close()
+	var client = NewClient(&ClientOptions{TokenSource: &countingTokenSource{}})
+	var resp, err = client.Request(&RequestOptions{URL: server.URL})
+	if err != nil || resp.StatusCode != netHttp.StatusUnauthorized || hits != 2 {
+		t.Errorf("got %v %v after %d requests, want the 401 after 2", resp, err, hits)
+	}
+}
+
+func TestCachedTokenSourceSharesRefresh(t *testing.T) {
+	var src = &countingTokenSource{gate: make(chan struct{})}
+	var cached = NewCachedTokenSource(src, 0)
+	var wg sync.WaitGroup
+	var tokens = make([]*Token, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = cached.Token(context.Background())
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(src.gate)
+	wg.Wait()
+	for i, token := range tokens {
+		if token == nil || token.AccessToken != "t1" {
+			t.Errorf("caller %d got %+v", i, token)
+		}
+	}
+	if src.calls != 1 {
+		t.Errorf("fetched %d tokens, want 1", src.calls)
+	}
+}
+
+func TestCachedTokenSourceRefreshesAhead(t *testing.T) {
+	var src = &countingTokenSource{expiry: 30 * time.Second}
+	var cached = NewCachedTokenSource(src, time.Minute)
+	var first, _ = cached.Token(context.Background())
+	// the token expires within a minute, it is still returned while the
+	// refresh runs in the background
+	var second, _ = cached.Token(context.Background())
+	if first.AccessToken != "t1" || second.AccessToken != "t1" {
+		t.Fatalf("got %s and %s, want t1 until the refresh is done", first.AccessToken, second.AccessToken)
+	}
+	var token = second
+	for deadline := time.Now().Add(time.Second); token.AccessToken == "t1" && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		token, _ = cached.Token(context.Background())
+	}
+	if token.AccessToken != "t2" {
+		t.Errorf("got %s, want the refreshed token", token.AccessToken)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	var tests = []struct {
+		name         string
+		authInParams bool
+	}{
+		{"basic auth", false},
+		{"auth in params", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+				r.ParseForm()
+				var id, secret, ok = r.BasicAuth()
+				if ok {
+					// the credentials are form encoded inside basic auth
+					id, _ = url.QueryUnescape(id)
+					secret, _ = url.QueryUnescape(secret)
+				} else {
+					id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+				}
+				if ok && r.PostForm.Get("client_secret") != "" {
+					netHttp.Error(w, "credentials sent twice", netHttp.StatusBadRequest)
+					return
+				}
+				if ok == tt.authInParams || id != "id" || secret != "s&cret" {
+					netHttp.Error(w, "bad credentials", netHttp.StatusUnauthorized)
+					return
+				}
+				if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "read write" || r.PostForm.Get("audience") != "api" {
+					netHttp.Error(w, "bad form "+r.PostForm.Encode(), netHttp.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"abc","token_type":"bearer","expires_in":"3600"}`))
+			}))
+			defer server.Close()
+
+			var src = NewClientCredentials(&ClientCredentialsOptions{
+				TokenURL:     server.URL,
+				ClientID:     "id",
+				ClientSecret: "s&cret",
+				Scopes:       []string{"read", "write"},
+				Params:       map[string]string{"audience": "api"},
+				AuthInParams: tt.authInParams,
+			}, nil)
+			var token, err = src.Token(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.AccessToken != "abc" || token.authorization() != "Bearer abc" {
+				t.Errorf("got token %+v", token)
+			}
+			if left := time.Until(token.Expiry); left < 59*time.Minute || left > time.Hour {
+				t.Errorf("token expires in %s, want an hour", left)
+			}
+		})
+	}
+}
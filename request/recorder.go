@@ -0,0 +1,351 @@
+package request
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RecorderMode decides if the recorder makes real requests or serves the cassette
+type RecorderMode int
+
+// Define the recorder modes
+const (
+	// ModeReplay serves the cassette and fails the requests missing from it
+	ModeReplay RecorderMode = iota
+	// ModeRecord makes the real requests and overwrites the cassette
+	ModeRecord
+	// ModeReplayOrRecord serves the cassette and records the missing requests
+	ModeReplayOrRecord
+)
+
+// RedactedValue replaces the redacted headers and query params in the cassette
+const RedactedValue = "REDACTED"
+
+// ErrInteractionNotFound is returned in replay mode when no recorded interaction matches the request
+var ErrInteractionNotFound = errors.New("request: no recorded interaction matches the request")
+
+// MatchOptions struct decides which parts of the request must be equal to the
+// recorded one, the method and url are always matched
+type MatchOptions struct {
+	Body    bool
+	Headers []string
+	// IgnoreQuery lists the query params which change on every run eg: timestamps
+	IgnoreQuery []string
+}
+
+// RecorderOptions struct contains the options of the record and replay transport
+type RecorderOptions struct {
+	// Path of the cassette file, it is created in record mode. The cassette is
+	// YAML when the extension is .yaml or .yml and JSON otherwise
+	Path  string
+	Mode  RecorderMode
+	Match MatchOptions
+	// RedactHeaders and RedactQuery are replaced with RedactedValue before saving,
+	// Authorization and Cookie headers are always redacted
+	RedactHeaders []string
+	RedactQuery   []string
+	// Redact can modify the interaction before it is saved eg: to mask the body.
+	// The live requests are redacted too before matching so it must be idempotent
+	Redact func(*Interaction)
+	// AllowRepeat serves the last matching interaction again once all are used
+	AllowRepeat bool
+}
+
+// RecordedRequest struct is the request saved in the cassette
+type RecordedRequest struct {
+	Method       string              `json:"method" yaml:"method"`
+	URL          string              `json:"url" yaml:"url"`
+	Header       map[string][]string `json:"header,omitempty" yaml:"header,omitempty"`
+	Body         string              `json:"body,omitempty" yaml:"body,omitempty"`
+	BodyEncoding string              `json:"bodyEncoding,omitempty" yaml:"bodyEncoding,omitempty"`
+}
+
+// RecordedResponse struct is the response saved in the cassette
+type RecordedResponse struct {
+	StatusCode   int                 `json:"code" yaml:"code"`
+	Status       string              `json:"status" yaml:"status"`
+	Header       map[string][]string `json:"header,omitempty" yaml:"header,omitempty"`
+	Body         string              `json:"body,omitempty" yaml:"body,omitempty"`
+	BodyEncoding string              `json:"bodyEncoding,omitempty" yaml:"bodyEncoding,omitempty"`
+}
+
+// Interaction struct is a request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request" yaml:"request"`
+	Response RecordedResponse `json:"response" yaml:"response"`
+	used     bool
+}
+
+type cassette struct {
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// Recorder is a round tripper which records the interactions to a cassette
+// file or replays them from it, it is meant for the tests of the code using Client
+type Recorder struct {
+	opts   RecorderOptions
+	next   netHttp.RoundTripper
+	mu     sync.Mutex
+	tape   *cassette
+	redact map[string]bool
+	query  map[string]bool
+}
+
+// NewRecorder method will load the cassette of the options, the file must
+// exist in replay mode. next makes the real requests, nil means the default transport
+func NewRecorder(opts *RecorderOptions, next netHttp.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = netHttp.DefaultTransport
+	}
+	var r = &Recorder{opts: *opts, next: next, tape: &cassette{}, redact: map[string]bool{}, query: map[string]bool{}}
+	for _, h := range append([]string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}, opts.RedactHeaders...) {
+		r.redact[netHttp.CanonicalHeaderKey(h)] = true
+	}
+	for _, q := range opts.RedactQuery {
+		r.query[q] = true
+	}
+	if opts.Mode == ModeRecord {
+		return r, nil
+	}
+	var data, err = ioutil.ReadFile(opts.Path)
+	if os.IsNotExist(err) && opts.Mode == ModeReplayOrRecord {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.yaml() {
+		err = yaml.Unmarshal(data, r.tape)
+	} else {
+		err = json.Unmarshal(data, r.tape)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("request: invalid cassette %s: %w", opts.Path, err)
+	}
+	return r, nil
+}
+
+func (r *Recorder) yaml() bool {
+	var ext = strings.ToLower(filepath.Ext(r.opts.Path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// Middleware method will return the recorder as a middleware, the rest of the
+// chain is used for the real requests
+func (r *Recorder) Middleware() Middleware {
+	return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+		r.mu.Lock()
+		r.next = next
+		r.mu.Unlock()
+		return r
+	}
+}
+
+// RoundTrip serves the request from the cassette or records it, the real
+// requests run concurrently and are added to the cassette as they complete
+func (r *Recorder) RoundTrip(req *netHttp.Request) (*netHttp.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var recorded = r.recordRequest(req, body)
+	if r.opts.Mode != ModeRecord {
+		if in := r.find(recorded); in != nil {
+			return in.Response.response(req), nil
+		}
+		if r.opts.Mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, recorded.Method, recorded.URL)
+		}
+	}
+
+	r.mu.Lock()
+	var next = r.next
+	r.mu.Unlock()
+	var outReq = req.Clone(req.Context())
+	outReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var resp, err = next.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	var in = &Interaction{Request: recorded, Response: RecordedResponse{StatusCode: resp.StatusCode, Status: resp.Status, Header: r.redactHeader(resp.Header)}, used: true}
+	in.Response.Body, in.Response.BodyEncoding = encodeBody(respBody)
+	if r.opts.Redact != nil {
+		r.opts.Redact(in)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tape.Interactions = append(r.tape.Interactions, in)
+	// saved after every interaction so that a failing test keeps what was recorded
+	return resp, r.save()
+}
+
+// recordRequest returns the request as it is saved in the cassette, Redact is
+// applied too so that the live request matches the redacted recording
+func (r *Recorder) recordRequest(req *netHttp.Request, body []byte) RecordedRequest {
+	var u = *req.URL
+	if len(r.query) > 0 && u.RawQuery != "" {
+		var values = u.Query()
+		for k := range values {
+			if r.query[k] {
+				values.Set(k, RedactedValue)
+			}
+		}
+		u.RawQuery = values.Encode()
+	}
+	var recorded = RecordedRequest{Method: req.Method, URL: u.String(), Header: r.redactHeader(req.Header)}
+	recorded.Body, recorded.BodyEncoding = encodeBody(body)
+	if r.opts.Redact != nil {
+		var in = &Interaction{Request: recorded}
+		r.opts.Redact(in)
+		recorded = in.Request
+	}
+	return recorded
+}
+
+func (r *Recorder) redactHeader(header netHttp.Header) map[string][]string {
+	if len(header) == 0 {
+		return nil
+	}
+	var redacted = header.Clone()
+	for k := range redacted {
+		if r.redact[netHttp.CanonicalHeaderKey(k)] {
+			redacted[k] = []string{RedactedValue}
+		}
+	}
+	return redacted
+}
+
+func (r *Recorder) find(req RecordedRequest) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last *Interaction
+	for _, in := range r.tape.Interactions {
+		if !r.matches(req, in.Request) {
+			continue
+		}
+		if !in.used {
+			in.used = true
+			return in
+		}
+		last = in
+	}
+	if r.opts.AllowRepeat {
+		return last
+	}
+	return nil
+}
+
+func (r *Recorder) matches(req, recorded RecordedRequest) bool {
+	if req.Method != recorded.Method || !r.sameURL(req.URL, recorded.URL) {
+		return false
+	}
+	if r.opts.Match.Body && (req.Body != recorded.Body || req.BodyEncoding != recorded.BodyEncoding) {
+		return false
+	}
+	for _, h := range r.opts.Match.Headers {
+		if netHttp.Header(req.Header).Get(h) != netHttp.Header(recorded.Header).Get(h) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Recorder) sameURL(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	var qa, qb = ua.Query(), ub.Query()
+	for _, k := range r.opts.Match.IgnoreQuery {
+		qa.Del(k)
+		qb.Del(k)
+	}
+	ua.RawQuery, ub.RawQuery = "", ""
+	// Encode sorts the keys so the order of the params does not matter
+	return ua.String() == ub.String() && qa.Encode() == qb.Encode()
+}
+
+// save writes the cassette to a temp file and renames it into place, it must
+// be called with the lock held
+func (r *Recorder) save() error {
+	var data []byte
+	var err error
+	if r.yaml() {
+		data, err = yaml.Marshal(r.tape)
+	} else {
+		data, err = json.MarshalIndent(r.tape, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(r.opts.Path), 0755); err != nil {
+		return err
+	}
+	var tmp = r.opts.Path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.opts.Path)
+}
+
+func (rr *RecordedResponse) response(req *netHttp.Request) *netHttp.Response {
+	var body = decodeBody(rr.Body, rr.BodyEncoding)
+	var status = rr.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", rr.StatusCode, netHttp.StatusText(rr.StatusCode))
+	}
+	return &netHttp.Response{
+		Status:        status,
+		StatusCode:    rr.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        netHttp.Header(rr.Header).Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// encodeBody keeps the text bodies readable in the cassette and base64 encodes the binary ones
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeBody(body, encoding string) []byte {
+	if strings.EqualFold(encoding, "base64") {
+		if data, err := base64.StdEncoding.DecodeString(body); err == nil {
+			return data
+		}
+	}
+	return []byte(body)
+}
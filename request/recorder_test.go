@@ -0,0 +1,141 @@
+package request
+
+import (
+	"errors"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRecordingServer(t *testing.T) *httptest.Server {
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		var body, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(r.Method + " " + r.URL.Path + " " + string(body)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func recorderClient(t *testing.T, opts *RecorderOptions) *Client {
+	t.Helper()
+	var rec, err = NewRecorder(opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(&ClientOptions{Transport: rec})
+}
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	for _, name := range []string{"cassette.json", "cassette.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			var server = newRecordingServer(t)
+			var path = filepath.Join(t.TempDir(), name)
+			var opts = &RecorderOptions{Path: path, Mode: ModeRecord, RedactQuery: []string{"key"}, Match: MatchOptions{Body: true}}
+			var request = &RequestOptions{Method: "POST", URL: server.URL + "/items", Query: map[string]string{"key": "secret"}, Body: "a=1", Headers: map[string]string{"Authorization": "Bearer secret"}}
+
+			var recorded, err = recorderClient(t, opts).Request(request)
+			if err != nil || recorded.Body != "POST /items a=1" {
+				t.Fatalf("record got %v %v", recorded, err)
+			}
+			var data, _ = ioutil.ReadFile(path)
+			if strings.Contains(string(data), "secret") || !strings.Contains(string(data), RedactedValue) {
+				t.Errorf("the cassette was not redacted:\n%s", data)
+			}
+
+			server.Close()
+			opts.Mode = ModeReplay
+			var client = recorderClient(t, opts)
+			replayed, err := client.Request(request)
+			if err != nil || replayed.Body != recorded.Body || replayed.StatusCode != 200 {
+				t.Errorf("replay got %v %v", replayed, err)
+			}
+			var other = *request
+			other.Body = "a=2"
+			if _, err := client.Request(&other); !errors.Is(err, ErrInteractionNotFound) {
+				t.Errorf("other body got %v, want ErrInteractionNotFound", err)
+			}
+		})
+	}
+}
+
+func TestRecorderMatchesRedactedBody(t *testing.T) {
+	var server = newRecordingServer(t)
+	var opts = &RecorderOptions{
+		Path:  filepath.Join(t.TempDir(), "cassette.json"),
+		Mode:  ModeRecord,
+		Match: MatchOptions{Body: true},
+		Redact: func(in *Interaction) {
+			in.Request.Body = strings.Replace(in.Request.Body, "token=abc", "token="+RedactedValue, 1)
+		},
+	}
+	var request = &RequestOptions{Method: "POST", URL: server.URL, Body: "token=abc&n=1"}
+	if _, err := recorderClient(t, opts).Request(request); err != nil {
+		t.Fatal(err)
+	}
+	opts.Mode = ModeReplay
+	if resp, err := recorderClient(t, opts).Request(request); err != nil || resp.Body != "POST / token=abc&n=1" {
+		t.Errorf("replay got %v %v, want the body matched after redaction", resp, err)
+	}
+}
+
+func TestRecorderAllowRepeat(t *testing.T) {
+	var server = newRecordingServer(t)
+	var opts = &RecorderOptions{Path: filepath.Join(t.TempDir(), "cassette.json"), Mode: ModeRecord}
+	if _, err := recorderClient(t, opts).Request(&RequestOptions{URL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	opts.Mode = ModeReplay
+	var client = recorderClient(t, opts)
+	client.Request(&RequestOptions{URL: server.URL})
+	if _, err := client.Request(&RequestOptions{URL: server.URL}); !errors.Is(err, ErrInteractionNotFound) {
+		t.Errorf("second replay got %v, want ErrInteractionNotFound", err)
+	}
+	opts.AllowRepeat = true
+	client = recorderClient(t, opts)
+	client.Request(&RequestOptions{URL: server.URL})
+	if _, err := client.Request(&RequestOptions{URL: server.URL}); err != nil {
+		t.Errorf("repeat got %v", err)
+	}
+}
+
+func TestRecorderConcurrentRequests(t *testing.T) {
+	// the server answers only once both requests arrived, a recorder which
+	// serialises the real requests would never get there
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		arrived.Done()
+		arrived.Wait()
+	}))
+	defer server.Close()
+
+	var path = filepath.Join(t.TempDir(), "cassette.json")
+	var client = recorderClient(t, &RecorderOptions{Path: path, Mode: ModeRecord})
+	var done = make(chan error, 2)
+	for _, p := range []string{"/a", "/b"} {
+		go func(p string) {
+			var _, err = client.Request(&RequestOptions{URL: server.URL + p})
+			done <- err
+		}(p)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the requests were serialised")
+		}
+	}
+	var rec, err = NewRecorder(&RecorderOptions{Path: path, Mode: ModeReplay}, nil)
+	if err != nil || len(rec.tape.Interactions) != 2 {
+		t.Errorf("cassette got %v %v, want 2 interactions", rec, err)
+	}
+}
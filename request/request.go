@@ -2,8 +2,11 @@ package request
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"io/ioutil"
 	netHttp "net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -12,23 +15,46 @@ import (
 // be long lived client
 type ClientOptions struct {
 	Timeout int
+	// Transport makes the requests, it is usually created with NewTransport.
+	// nil uses the TransportOptions or else http.DefaultTransport
+	Transport netHttp.RoundTripper
+	// TransportOptions builds the transport with NewTransport when Transport is nil
+	TransportOptions *TransportOptions
+	Breaker          *BreakerOptions // enables the per host circuit breaker
+	// Middlewares wrap every round trip, the first one is the outermost
+	Middlewares []Middleware
+	// Cache enables the response cache, it is placed after the middlewares
+	// right above the transport so that it sees the credentials they set
+	Cache *CacheOptions
+	// TokenSource sets the OAuth2 token on every request, it is cached with
+	// NewCachedTokenSource unless it is already a *CachedTokenSource
+	TokenSource TokenSource
 }
 
 // Client struct contains reference to internal http client
 type Client struct {
 	backendClient *netHttp.Client
+	breaker       *CircuitBreaker
+	baseTransport netHttp.RoundTripper
+	middlewares   []Middleware
+	cache         Middleware
 }
 
 // RequestOptions struct
 type RequestOptions struct {
-	Method  string
-	URL     string
-	Body    string
+	Method string
+	URL    string
+	Body   string
+	// GetBody returns a new reader of the body for every attempt, it is used
+	// instead of Body to stream large bodies eg: multipart uploads
+	GetBody func() (io.ReadCloser, error)
 	Retries int
 	Query   map[string]string
 	Headers map[string]string
 
 	RetryInterval time.Duration // retry after x milliseconds
+	RetryPolicy   *RetryPolicy  // nil retries only the transport errors with fixed interval
+	Timeout       time.Duration // overrides the client timeout for each attempt
 }
 
 // Response struct
@@ -39,35 +65,145 @@ type Response struct {
 	Cookies      []*netHttp.Cookie
 	Latency      int64
 	Retries      int
+	Attempts     []Attempt
 }
 
-// NewClient method returns a pointer to the Client
+// NewClient method returns a pointer to the Client, the default transport is
+// used when the transport can not be built from the TransportOptions. Use
+// NewClientWithOptions to handle the error instead
 func NewClient(opts *ClientOptions) *Client {
+	var client, err = NewClientWithOptions(opts)
+	if err != nil {
+		var copied = *opts
+		copied.TransportOptions = nil
+		client, _ = NewClientWithOptions(&copied)
+	}
+	return client
+}
+
+// NewClientWithOptions method returns a pointer to the Client, the error is
+// returned when the transport can not be built from the TransportOptions
+func NewClientWithOptions(opts *ClientOptions) (*Client, error) {
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
 	var c = &netHttp.Client{
 		Timeout: time.Duration(opts.Timeout) * time.Second,
 	}
-	var client = &Client{backendClient: c}
-	return client
+	var client = &Client{backendClient: c, baseTransport: netHttp.DefaultTransport}
+	var transport = opts.Transport
+	if transport == nil && opts.TransportOptions != nil {
+		var t, err = NewTransport(opts.TransportOptions)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	}
+	if transport != nil {
+		client.baseTransport = transport
+	}
+	if opts.Breaker != nil {
+		client.breaker = NewCircuitBreaker(opts.Breaker)
+	}
+	if opts.Cache != nil {
+		client.cache = CacheMiddleware(opts.Cache)
+	}
+	if opts.TokenSource != nil {
+		var cached, ok = opts.TokenSource.(*CachedTokenSource)
+		if !ok {
+			cached = NewCachedTokenSource(opts.TokenSource, 0)
+		}
+		client.Use(OAuthMiddleware(cached))
+	}
+	client.Use(opts.Middlewares...)
+	return client, nil
 }
 
-// Request method will make a request
-func (c *Client) Request(opts *RequestOptions) (*Response, error) {
-	var url = opts.URL
-	if !strings.Contains(opts.URL, "?") {
-		url += "?"
+func newRequest(ctx context.Context, opts *RequestOptions, reqURL string, body []byte) (*netHttp.Request, error) {
+	// a new reader is created for every attempt since the previous one is consumed
+	var reader io.Reader = bytes.NewReader(body)
+	if opts.GetBody != nil {
+		var rc, err = opts.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		reader = rc
 	}
-	for k, v := range opts.Query {
-		url += "&" + k + "=" + v
+	var req, err = netHttp.NewRequestWithContext(ctx, opts.Method, reqURL, reader)
+	if err != nil {
+		if rc, ok := reader.(io.Closer); ok {
+			rc.Close()
+		}
+		return nil, err
+	}
+	if opts.GetBody != nil {
+		req.GetBody = opts.GetBody
 	}
-	byteBody := []byte(opts.Body)
-	var body = bytes.NewBuffer(byteBody)
-	var req, err = netHttp.NewRequest(opts.Method, url, body)
 	for k, v := range opts.Headers {
 		req.Header.Set(k, v)
 	}
-	if err != nil {
-		return nil, err
+	return req, nil
+}
+
+// buildURL appends the encoded query params to the url keeping the query
+// already present in the url as it is
+func buildURL(rawURL string, query map[string]string) string {
+	if len(query) == 0 {
+		return rawURL
+	}
+	var values = url.Values{}
+	for k, v := range query {
+		values.Set(k, v)
+	}
+	var fragment string
+	if i := strings.Index(rawURL, "#"); i >= 0 {
+		rawURL, fragment = rawURL[:i], rawURL[i:]
+	}
+	switch {
+	case !strings.Contains(rawURL, "?"):
+		rawURL += "?"
+	case !strings.HasSuffix(rawURL, "?") && !strings.HasSuffix(rawURL, "&"):
+		rawURL += "&"
+	}
+	return rawURL + values.Encode() + fragment
+}
+
+// sleep waits for the duration or till the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	var timer = time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Breaker method will return the circuit breaker of the client, nil when it is not enabled
+func (c *Client) Breaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// Request method will make a request
+func (c *Client) Request(opts *RequestOptions) (*Response, error) {
+	return c.RequestContext(context.Background(), opts)
+}
+
+// RequestContext method will make a request which is cancelled along with the
+// retries and the waits between them as soon as the context is done
+func (c *Client) RequestContext(ctx context.Context, opts *RequestOptions) (*Response, error) {
+	var httpClient = c.backendClient
+	if opts.Timeout > 0 {
+		var override = *c.backendClient
+		override.Timeout = opts.Timeout
+		httpClient = &override
 	}
+	var reqURL = buildURL(opts.URL, opts.Query)
+	byteBody := []byte(opts.Body)
 	var lastError error
 	if opts.RetryInterval == 0 {
 		opts.RetryInterval = 1 * time.Second
@@ -77,17 +213,50 @@ func (c *Client) Request(opts *RequestOptions) (*Response, error) {
 	}
 	var respData = &Response{}
 	for index := 0; index < opts.Retries; index++ {
+		var req, err = newRequest(ctx, opts, reqURL, byteBody)
+		if err != nil {
+			if index > 0 {
+				// the body could not be reopened for the retry
+				return respData, lastError
+			}
+			return nil, err
+		}
+		var generation uint64
+		if c.breaker != nil {
+			if generation, err = c.breaker.Allow(req.URL.Host); err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				// fail fast, retrying is pointless till the circuit is open
+				return respData, err
+			}
+		}
 		start := time.Now()
-		var resp, err = c.backendClient.Do(req)
+		resp, err := httpClient.Do(req)
+		latency := (time.Now().UnixNano() - start.UnixNano()) / 1000000
+		if c.breaker != nil {
+			var statusCode int
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+			c.breaker.Record(req.URL.Host, generation, statusCode, err)
+		}
+		var attempt = Attempt{Error: err, Latency: latency}
+		var lastAttempt = index == opts.Retries-1
 		if err != nil {
 			lastError = err
 			// If request is failed then retry after sleeping for some time
-			time.Sleep(opts.RetryInterval)
+			if !lastAttempt {
+				attempt.Wait = opts.RetryPolicy.backoff(index, opts.RetryInterval)
+			}
+			respData.Attempts = append(respData.Attempts, attempt)
+			if sleepErr := sleep(ctx, attempt.Wait); sleepErr != nil {
+				return respData, lastError
+			}
 			continue
 		}
-		latency := (time.Now().UnixNano() - start.UnixNano()) / 1000000
-		defer resp.Body.Close()
 		body, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
 		respData.Body = string(body)
 		respData.Status = resp.Status
 		respData.StatusCode = resp.StatusCode
@@ -95,10 +264,25 @@ func (c *Client) Request(opts *RequestOptions) (*Response, error) {
 		respData.Header = resp.Header
 		respData.Latency = latency
 		respData.Retries = index
+		attempt.StatusCode = resp.StatusCode
+		attempt.Error = readErr
 
 		if readErr != nil {
+			respData.Attempts = append(respData.Attempts, attempt)
 			return respData, readErr
 		}
+		lastError = nil
+		if !lastAttempt && opts.RetryPolicy.retryStatus(resp.StatusCode) {
+			if wait, ok := opts.RetryPolicy.wait(index, opts.RetryInterval, resp.Header); ok {
+				attempt.Wait = wait
+				respData.Attempts = append(respData.Attempts, attempt)
+				if sleepErr := sleep(ctx, wait); sleepErr != nil {
+					return respData, sleepErr
+				}
+				continue
+			}
+		}
+		respData.Attempts = append(respData.Attempts, attempt)
 		break // since it is success break out of the for loop
 	}
 	return respData, lastError
@@ -0,0 +1,27 @@
+package request
+
+import (
+	netHttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClientInvalidTransport(t *testing.T) {
+	var opts = &ClientOptions{TransportOptions: &TransportOptions{ProxyURL: "://bad"}}
+	if client, err := NewClientWithOptions(opts); err == nil || client != nil {
+		t.Errorf("got %v %v, want the proxy url error", client, err)
+	}
+
+	var server = httptest.NewServer(netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	// NewClient falls back to the default transport instead of panicking
+	var client = NewClient(opts)
+	if client.baseTransport != netHttp.DefaultTransport {
+		t.Errorf("got transport %T, want the default transport", client.baseTransport)
+	}
+	if resp, err := client.Request(&RequestOptions{URL: server.URL}); err != nil || resp.Body != "ok" {
+		t.Errorf("got %v %v", resp, err)
+	}
+}
@@ -0,0 +1,120 @@
+package request
+
+import (
+	"math"
+	"math/rand"
+	netHttp "net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy struct decides which responses are retried and how long to wait
+// between the attempts. The wait starts at RequestOptions.RetryInterval and is
+// multiplied after every attempt
+type RetryPolicy struct {
+	StatusCodes   []int         // response status codes which are retried
+	Multiplier    float64       // defaults to 2
+	MaxInterval   time.Duration // upper bound of the wait between attempts, defaults to 30s
+	Jitter        float64       // fraction of the wait randomised eg: 0.2 means +-20%
+	MaxRetryAfter time.Duration // stop retrying when the server asks to wait longer than this
+}
+
+// Attempt struct contains the result of a single try of the request
+type Attempt struct {
+	StatusCode int
+	Error      error
+	Latency    int64         // in milliseconds
+	Wait       time.Duration // time slept before the next attempt
+}
+
+// DefaultRetryPolicy method will return a policy which retries the throttled
+// and unavailable responses with exponential backoff and jitter, a Retry-After
+// longer than a minute stops the retries
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		StatusCodes:   []int{netHttp.StatusTooManyRequests, netHttp.StatusBadGateway, netHttp.StatusServiceUnavailable, netHttp.StatusGatewayTimeout},
+		Multiplier:    2,
+		MaxInterval:   30 * time.Second,
+		Jitter:        0.2,
+		MaxRetryAfter: time.Minute,
+	}
+}
+
+func (p *RetryPolicy) retryStatus(code int) bool {
+	if p == nil {
+		return false
+	}
+	for _, c := range p.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultMaxRetryInterval bounds the backoff of the policies without MaxInterval
+const defaultMaxRetryInterval = 30 * time.Second
+
+// backoff returns the wait before the next attempt, without a policy the
+// interval is fixed as it was before the policies were added. The wait is
+// clamped before the jitter since the exponent overflows time.Duration after
+// a few dozen attempts and again after it so that MaxInterval is never exceeded
+func (p *RetryPolicy) backoff(attempt int, interval time.Duration) time.Duration {
+	if p == nil {
+		return interval
+	}
+	if interval <= 0 {
+		return 0
+	}
+	var multiplier = p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	var maxInterval = p.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultMaxRetryInterval
+	}
+	var wait = float64(interval) * math.Pow(multiplier, float64(attempt))
+	if math.IsNaN(wait) || wait > float64(maxInterval) {
+		wait = float64(maxInterval)
+	}
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if wait > float64(maxInterval) {
+		wait = float64(maxInterval)
+	}
+	return time.Duration(wait)
+}
+
+// wait returns the wait before retrying the response, the Retry-After header
+// takes precedence over the backoff. ok is false when the server asks to wait
+// longer than MaxRetryAfter
+func (p *RetryPolicy) wait(attempt int, interval time.Duration, header netHttp.Header) (time.Duration, bool) {
+	var wait = p.backoff(attempt, interval)
+	if retryAfter, found := parseRetryAfter(header.Get("Retry-After")); found {
+		if p.MaxRetryAfter > 0 && retryAfter > p.MaxRetryAfter {
+			return 0, false
+		}
+		wait = retryAfter
+	}
+	return wait, true
+}
+
+// parseRetryAfter parses the header which is either delay in seconds or a http date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := netHttp.ParseTime(value); err == nil {
+		var wait = time.Until(t)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,80 @@
+package request
+
+import (
+	netHttp "net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	var tests = []struct {
+		name     string
+		policy   *RetryPolicy
+		attempt  int
+		interval time.Duration
+		want     time.Duration
+	}{
+		{"no policy keeps the interval", nil, 5, time.Second, time.Second},
+		{"first attempt", &RetryPolicy{}, 0, time.Second, time.Second},
+		{"default multiplier", &RetryPolicy{}, 3, time.Second, 8 * time.Second},
+		{"custom multiplier", &RetryPolicy{Multiplier: 3}, 2, time.Second, 9 * time.Second},
+		{"clamped to MaxInterval", &RetryPolicy{MaxInterval: 5 * time.Second}, 10, time.Second, 5 * time.Second},
+		{"default MaxInterval", &RetryPolicy{}, 10, time.Second, defaultMaxRetryInterval},
+		{"exponent overflow", &RetryPolicy{}, 5000, time.Second, defaultMaxRetryInterval},
+		{"no interval", &RetryPolicy{}, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.backoff(tt.attempt, tt.interval); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffJitter(t *testing.T) {
+	var policy = &RetryPolicy{MaxInterval: 10 * time.Second, Jitter: 0.5}
+	for i := 0; i < 1000; i++ {
+		// 4s is jittered within 2s and 6s
+		if got := policy.backoff(2, time.Second); got < 2*time.Second || got > 6*time.Second {
+			t.Fatalf("attempt 2 got %v, want 2s to 6s", got)
+		}
+		// the jitter is applied before the clamp so MaxInterval is never exceeded
+		if got := policy.backoff(20, time.Second); got < 5*time.Second || got > policy.MaxInterval {
+			t.Fatalf("attempt 20 got %v, want 5s to 10s", got)
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	var policy = DefaultRetryPolicy()
+	policy.Jitter = 0
+	if policy.MaxRetryAfter <= 0 {
+		t.Fatal("the default policy must cap Retry-After")
+	}
+
+	var tests = []struct {
+		name       string
+		retryAfter string
+		want       time.Duration
+		ok         bool
+	}{
+		{"backoff without header", "", 4 * time.Second, true},
+		{"seconds", "3", 3 * time.Second, true},
+		{"invalid header", "soon", 4 * time.Second, true},
+		{"date in the past", "Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+		{"longer than MaxRetryAfter", "3600", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header = netHttp.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+			var got, ok = policy.wait(2, time.Second, header)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got %v %v, want %v %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
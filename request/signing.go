@@ -0,0 +1,260 @@
+package request
+
+import (
+	"bytes"
+	"crypto/hmac"
+	cryptoRand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trustsignalio/golangutils/security"
+)
+
+// Define the headers of the signed requests
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Signature-Timestamp"
+	NonceHeader     = "X-Signature-Nonce"
+	KeyIDHeader     = "X-Signature-Key-Id"
+)
+
+const defaultMaxSkew = 5 * time.Minute
+const defaultMaxSignedBody = 10 << 20
+
+// Define the errors returned by the signature verification
+var (
+	ErrSignatureMissing  = errors.New("request: signature headers are missing")
+	ErrSignatureInvalid  = errors.New("request: signature is invalid")
+	ErrSignatureExpired  = errors.New("request: signature timestamp is outside the allowed window")
+	ErrSignatureReplayed = errors.New("request: signature nonce was already used")
+	ErrUnknownKeyID      = errors.New("request: unknown signature key id")
+)
+
+// SigningOptions struct contains the options of the outbound request signing
+type SigningOptions struct {
+	KeyID  string // sent in X-Signature-Key-Id when not empty
+	Secret []byte
+}
+
+// VerifyOptions struct contains the options of the inbound signature verification
+type VerifyOptions struct {
+	// Secret returns the secret of the key id, the key id is empty when the
+	// sender does not send one
+	Secret func(keyID string) ([]byte, bool)
+	// MaxSkew is the allowed difference between the timestamp and the local clock
+	MaxSkew time.Duration
+	// Nonces remembers the used nonces, nil uses an in memory store which only
+	// protects a single instance of the service
+	Nonces      NonceStore
+	MaxBodySize int64
+	// OnError writes the response of a rejected request, by default 401 is sent
+	OnError func(w netHttp.ResponseWriter, r *netHttp.Request, err error)
+}
+
+// NonceStore remembers the nonces of the verified requests
+type NonceStore interface {
+	// Use must atomically mark the nonce as used for ttl and return false when
+	// it was already used
+	Use(nonce string, ttl time.Duration) bool
+}
+
+// defaultNonces is used when the options do not set a store
+var defaultNonces = NewMemoryNonceStore()
+
+type memoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryNonceStore method will return a nonce store which keeps the nonces in memory
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+func (m *memoryNonceStore) Use(nonce string, ttl time.Duration) bool {
+	var now = time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) > ttl {
+		for k, expiry := range m.nonces {
+			if now.After(expiry) {
+				delete(m.nonces, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	if expiry, ok := m.nonces[nonce]; ok && now.Before(expiry) {
+		return false
+	}
+	m.nonces[nonce] = now.Add(ttl)
+	return true
+}
+
+// CanonicalString method will return the string which is signed, it is made
+// of the method, path, sorted query, hex sha256 of the body, timestamp and nonce
+// separated by new lines
+func CanonicalString(method, path string, query url.Values, body []byte, timestamp, nonce string) string {
+	var keys = make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		var values = append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	if path == "" {
+		path = "/"
+	}
+	var bodyHash = sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method), path, strings.Join(pairs, "&"),
+		hex.EncodeToString(bodyHash[:]), timestamp, nonce,
+	}, "\n")
+}
+
+// Sign method will return the hex HMAC-SHA256 of the canonical string
+func Sign(secret []byte, canonical string) string {
+	return hex.EncodeToString(security.Sha256Hmac([]byte(canonical), secret))
+}
+
+func newNonce() (string, error) {
+	var b = make([]byte, 16)
+	if _, err := io.ReadFull(cryptoRand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// readBody reads the body of the request and puts back a reader of the same
+// bytes so that it can be sent or handled after the signature is computed
+func readBody(req *netHttp.Request, limit int64) ([]byte, error) {
+	if req.Body == nil || req.Body == netHttp.NoBody {
+		return nil, nil
+	}
+	var reader io.Reader = req.Body
+	if limit > 0 {
+		reader = io.LimitReader(req.Body, limit+1)
+	}
+	var body, err = ioutil.ReadAll(reader)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, errors.New("request: body is too large to verify the signature")
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// SigningMiddleware method will sign every request with the secret, the body
+// is read into memory to compute its hash so it must not be used for large uploads
+func SigningMiddleware(opts *SigningOptions) Middleware {
+	return func(next netHttp.RoundTripper) netHttp.RoundTripper {
+		return RoundTripperFunc(func(req *netHttp.Request) (*netHttp.Response, error) {
+			req = req.Clone(req.Context())
+			var body, err = readBody(req, 0)
+			if err != nil {
+				return nil, err
+			}
+			nonce, err := newNonce()
+			if err != nil {
+				return nil, err
+			}
+			var timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+			var canonical = CanonicalString(req.Method, req.URL.EscapedPath(), req.URL.Query(), body, timestamp, nonce)
+			req.Header.Set(TimestampHeader, timestamp)
+			req.Header.Set(NonceHeader, nonce)
+			req.Header.Set(SignatureHeader, Sign(opts.Secret, canonical))
+			if opts.KeyID != "" {
+				req.Header.Set(KeyIDHeader, opts.KeyID)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// VerifySignature method will verify the signature of the inbound request, the
+// body of the request can still be read after it
+func VerifySignature(r *netHttp.Request, opts *VerifyOptions) error {
+	var signature, timestamp, nonce = r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader), r.Header.Get(NonceHeader)
+	if signature == "" || timestamp == "" || nonce == "" {
+		return ErrSignatureMissing
+	}
+	var secret, ok = opts.Secret(r.Header.Get(KeyIDHeader))
+	if !ok {
+		return ErrUnknownKeyID
+	}
+	var maxSkew = opts.MaxSkew
+	if maxSkew == 0 {
+		maxSkew = defaultMaxSkew
+	}
+	var unix, err = strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	var skew = time.Since(time.Unix(unix, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return ErrSignatureExpired
+	}
+	var maxBody = opts.MaxBodySize
+	if maxBody == 0 {
+		maxBody = defaultMaxSignedBody
+	}
+	body, err := readBody(r, maxBody)
+	if err != nil {
+		return err
+	}
+	var canonical = CanonicalString(r.Method, r.URL.EscapedPath(), r.URL.Query(), body, timestamp, nonce)
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, security.Sha256Hmac([]byte(canonical), secret)) {
+		return ErrSignatureInvalid
+	}
+	// the nonce is used only after the signature is verified so that forged
+	// requests can not burn the nonces of the real ones. It is remembered for
+	// the whole window in which the timestamp is accepted
+	var nonces = opts.Nonces
+	if nonces == nil {
+		nonces = defaultNonces
+	}
+	if !nonces.Use(nonce, 2*maxSkew) {
+		return ErrSignatureReplayed
+	}
+	return nil
+}
+
+// VerifyMiddleware method will return a http middleware which rejects the
+// requests without a valid signature
+func VerifyMiddleware(opts *VerifyOptions) func(netHttp.Handler) netHttp.Handler {
+	var copied = *opts
+	if copied.OnError == nil {
+		copied.OnError = func(w netHttp.ResponseWriter, r *netHttp.Request, err error) {
+			netHttp.Error(w, netHttp.StatusText(netHttp.StatusUnauthorized), netHttp.StatusUnauthorized)
+		}
+	}
+	return func(next netHttp.Handler) netHttp.Handler {
+		return netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+			if err := VerifySignature(r, &copied); err != nil {
+				copied.OnError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
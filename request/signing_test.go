@@ -0,0 +1,121 @@
+package request
+
+import (
+	"errors"
+	"io/ioutil"
+	netHttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("secret")
+
+func testSecrets(keyID string) ([]byte, bool) {
+	if keyID == "" || keyID == "k1" {
+		return testSecret, true
+	}
+	return nil, false
+}
+
+func TestCanonicalString(t *testing.T) {
+	var want = "POST\n/a%20b\na=1&a=2&b=x+y\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n100\nn"
+	// the order of the query keys and values must not change the signature
+	for _, query := range []url.Values{
+		{"a": {"1", "2"}, "b": {"x y"}},
+		{"b": {"x y"}, "a": {"2", "1"}},
+	} {
+		var got = CanonicalString("post", "/a%20b", query, nil, "100", "n")
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if sig := Sign(testSecret, got); sig != "98010a183b8688a0650f7801d1af54817433e9c4829964b9fab7234e4009d1e1" {
+			t.Errorf("got signature %s", sig)
+		}
+	}
+	if got := CanonicalString("GET", "", nil, nil, "1", "n"); !strings.HasPrefix(got, "GET\n/\n\n") {
+		t.Errorf("empty path got %q", got)
+	}
+}
+
+func TestSigningRoundTrip(t *testing.T) {
+	var handler = netHttp.HandlerFunc(func(w netHttp.ResponseWriter, r *netHttp.Request) {
+		// the body is still readable after the verification
+		var body, _ = ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+	var server = httptest.NewServer(VerifyMiddleware(&VerifyOptions{Secret: testSecrets})(handler))
+	defer server.Close()
+
+	var tests = []struct {
+		name   string
+		opts   *SigningOptions
+		status int
+	}{
+		{"signed", &SigningOptions{Secret: testSecret}, 200},
+		{"signed with key id", &SigningOptions{KeyID: "k1", Secret: testSecret}, 200},
+		{"unknown key id", &SigningOptions{KeyID: "k2", Secret: testSecret}, 401},
+		{"wrong secret", &SigningOptions{Secret: []byte("other")}, 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client = NewClient(&ClientOptions{Middlewares: []Middleware{SigningMiddleware(tt.opts)}})
+			var resp, err = client.Request(&RequestOptions{Method: "POST", URL: server.URL + "/hook/a b", Query: map[string]string{"z": "1", "a": "x y"}, Body: `{"id":1}`})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("got %d %q, want %d", resp.StatusCode, resp.Body, tt.status)
+			}
+			if tt.status == 200 && resp.Body != `{"id":1}` {
+				t.Errorf("handler read %q", resp.Body)
+			}
+		})
+	}
+}
+
+func signedRequest(body string, timestamp time.Time, nonce string) *netHttp.Request {
+	var r = httptest.NewRequest("POST", "/hook?b=2&a=1", strings.NewReader(body))
+	var ts = strconv.FormatInt(timestamp.Unix(), 10)
+	r.Header.Set(TimestampHeader, ts)
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(SignatureHeader, Sign(testSecret, CanonicalString("POST", "/hook", r.URL.Query(), []byte(body), ts, nonce)))
+	return r
+}
+
+func TestVerifySignature(t *testing.T) {
+	var opts = &VerifyOptions{Secret: testSecrets, MaxSkew: time.Minute, Nonces: NewMemoryNonceStore(), MaxBodySize: 16}
+
+	var tampered = signedRequest("body", time.Now(), "n2")
+	tampered.Body = ioutil.NopCloser(strings.NewReader("other"))
+	var missing = signedRequest("body", time.Now(), "n3")
+	missing.Header.Del(SignatureHeader)
+
+	var tests = []struct {
+		name string
+		req  *netHttp.Request
+		err  error
+	}{
+		{"valid", signedRequest("body", time.Now(), "n1"), nil},
+		{"replayed nonce", signedRequest("body", time.Now(), "n1"), ErrSignatureReplayed},
+		{"tampered body", tampered, ErrSignatureInvalid},
+		{"missing signature", missing, ErrSignatureMissing},
+		{"expired", signedRequest("body", time.Now().Add(-2*time.Minute), "n4"), ErrSignatureExpired},
+		{"from the future", signedRequest("body", time.Now().Add(2*time.Minute), "n5"), ErrSignatureExpired},
+		// the forged request must not burn the nonce of the real one
+		{"valid after tampered nonce", signedRequest("body", time.Now(), "n2"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifySignature(tt.req, opts); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+	if err := VerifySignature(signedRequest(strings.Repeat("x", 17), time.Now(), "n6"), opts); err == nil {
+		t.Error("a body over MaxBodySize was verified")
+	}
+}
@@ -0,0 +1,82 @@
+package request
+
+import (
+	"container/list"
+	"sync"
+)
+
+const defaultUACacheSize = 10000
+
+// maxCachedUALength keeps the oversized user agents, which are mostly junk or
+// abuse, from taking the cache memory
+const maxCachedUALength = 512
+
+// uaCache memoises the parsed user agents since the same ones repeat a lot
+var uaCache = newDeviceLRU(defaultUACacheSize)
+
+type deviceLRU struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type deviceEntry struct {
+	ua     string
+	device Device
+}
+
+func newDeviceLRU(size int) *deviceLRU {
+	return &deviceLRU{size: size, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// SetUACacheSize method will resize the cache of ParseUA, zero disables it
+func SetUACacheSize(size int) {
+	uaCache.mu.Lock()
+	defer uaCache.mu.Unlock()
+	uaCache.size = size
+	uaCache.evict()
+}
+
+// PurgeUACache method will remove the memoised results of ParseUA
+func PurgeUACache() {
+	uaCache.mu.Lock()
+	defer uaCache.mu.Unlock()
+	uaCache.order.Init()
+	uaCache.items = make(map[string]*list.Element)
+}
+
+func (c *deviceLRU) get(ua string) (Device, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var el, ok = c.items[ua]
+	if !ok {
+		return Device{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*deviceEntry).device, true
+}
+
+func (c *deviceLRU) add(ua string, device Device) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 || len(ua) > maxCachedUALength {
+		return
+	}
+	if el, ok := c.items[ua]; ok {
+		el.Value.(*deviceEntry).device = device
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[ua] = c.order.PushFront(&deviceEntry{ua: ua, device: device})
+	c.evict()
+}
+
+// evict must be called with the lock held
+func (c *deviceLRU) evict() {
+	for c.order.Len() > c.size && c.order.Len() > 0 {
+		var el = c.order.Back()
+		c.order.Remove(el)
+		delete(c.items, el.Value.(*deviceEntry).ua)
+	}
+}